@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"inventory-backend/models"
+	"inventory-backend/utils"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
@@ -14,14 +18,37 @@ import (
 
 // Config holds application configuration
 type Config struct {
-	Port      string
-	DBHost    string
-	DBPort    string
-	DBUser    string
-	DBPass    string
-	DBName    string
-	JWTSecret string
-	DB        *gorm.DB
+	Port          string
+	DBHost        string
+	DBPort        string
+	DBUser        string
+	DBPass        string
+	DBName        string
+	JWTSecret     string
+	JWTExpiry     time.Duration
+	RefreshExpiry time.Duration
+	FrontendURL   string
+	InviteExpiry  time.Duration
+	// Password reset links expire after PasswordResetExpiry; each email may request PasswordResetMaxPerHour links per hour
+	PasswordResetExpiry      time.Duration
+	PasswordResetMaxPerHour  int
+	PasswordPolicy           utils.PasswordPolicy
+	EmailVerificationExpiry  time.Duration
+	RequireEmailVerification bool
+	// RegistrationMode controls public self-registration: "staff" (default) or "closed"
+	RegistrationMode string
+	// Login throttling: accounts lock after LoginMaxAttempts failures, IPs are blocked after LoginMaxIPAttempts
+	LoginMaxAttempts   int
+	LoginMaxIPAttempts int
+	LoginLockout       time.Duration
+	TOTPIssuer         string
+	RequireAdmin2FA    bool
+	OIDC               utils.OIDCConfig
+	// Product attachments are kept in Storage; uploads larger than AttachmentMaxSize bytes are rejected
+	StorageConfig     utils.StorageConfig
+	AttachmentMaxSize int64
+	Storage           utils.Storage
+	DB                *gorm.DB
 }
 
 // Load reads config from environment variables with defaults
@@ -30,22 +57,107 @@ func Load() *Config {
 	_ = godotenv.Load()
 
 	return &Config{
-		Port:      getEnv("PORT", "8080"),
-		DBHost:    getEnv("DB_HOST", "localhost"),
-		DBPort:    getEnv("DB_PORT", "5432"),
-		DBUser:    getEnv("DB_USER", "postgres"),
-		DBPass:    getEnv("DB_PASS", "password"),
-		DBName:    getEnv("DB_NAME", "gudang"),
-		JWTSecret: getEnv("JWT_SECRET", "your-secret-key"),
+		Port:          getEnv("PORT", "8080"),
+		DBHost:        getEnv("DB_HOST", "localhost"),
+		DBPort:        getEnv("DB_PORT", "5432"),
+		DBUser:        getEnv("DB_USER", "postgres"),
+		DBPass:        getEnv("DB_PASS", "password"),
+		DBName:        getEnv("DB_NAME", "gudang"),
+		JWTSecret:     getEnv("JWT_SECRET", ""),
+		JWTExpiry:     getEnvDuration("JWT_EXPIRY", 15*time.Minute),
+		RefreshExpiry: getEnvDuration("REFRESH_TOKEN_EXPIRY", 7*24*time.Hour),
+		FrontendURL:   strings.TrimRight(getEnv("FRONTEND_URL", "http://localhost:3000"), "/"),
+		InviteExpiry:  getEnvDuration("INVITE_EXPIRY", 72*time.Hour),
+
+		PasswordResetExpiry:     getEnvDuration("PASSWORD_RESET_EXPIRY", time.Hour),
+		PasswordResetMaxPerHour: getEnvInt("PASSWORD_RESET_MAX_PER_HOUR", 3),
+
+		PasswordPolicy: utils.PasswordPolicy{
+			MinLength:      getEnvInt("PASSWORD_MIN_LENGTH", 8),
+			RequireUpper:   getEnvBool("PASSWORD_REQUIRE_UPPER", true),
+			RequireLower:   getEnvBool("PASSWORD_REQUIRE_LOWER", true),
+			RequireDigit:   getEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+			RequireSymbol:  getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+			HistorySize:    getEnvInt("PASSWORD_HISTORY_SIZE", 5),
+			DisallowCommon: getEnvBool("PASSWORD_BLOCK_COMMON", true),
+		},
+		EmailVerificationExpiry:  getEnvDuration("EMAIL_VERIFICATION_EXPIRY", 24*time.Hour),
+		RequireEmailVerification: getEnvBool("REQUIRE_EMAIL_VERIFICATION", true),
+
+		RegistrationMode: getEnv("REGISTRATION_MODE", "staff"),
+
+		LoginMaxAttempts:   getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+		LoginMaxIPAttempts: getEnvInt("LOGIN_MAX_IP_ATTEMPTS", 20),
+		LoginLockout:       getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		TOTPIssuer:         getEnv("TOTP_ISSUER", "Inventory System"),
+		RequireAdmin2FA:    getEnvBool("REQUIRE_ADMIN_2FA", false),
+
+		OIDC: utils.OIDCConfig{
+			Issuer:               getEnv("OIDC_ISSUER", ""),
+			ClientID:             getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:         getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:          getEnv("OIDC_REDIRECT_URL", strings.TrimRight(getEnv("FRONTEND_URL", "http://localhost:3000"), "/")+"/auth/callback"),
+			Scopes:               getEnvList("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+			EmailClaim:           getEnv("OIDC_EMAIL_CLAIM", "email"),
+			GroupsClaim:          getEnv("OIDC_GROUPS_CLAIM", "groups"),
+			AdminGroups:          getEnvList("OIDC_ADMIN_GROUPS", nil),
+			StaffGroups:          getEnvList("OIDC_STAFF_GROUPS", nil),
+			AutoProvision:        getEnvBool("OIDC_AUTO_PROVISION", false),
+			TrustUnverifiedEmail: getEnvBool("OIDC_TRUST_UNVERIFIED_EMAIL", false),
+			TrustIdPMFA:          getEnvBool("OIDC_TRUST_IDP_MFA", false),
+		},
+
+		StorageConfig: utils.StorageConfig{
+			Driver:      getEnv("STORAGE_DRIVER", "local"),
+			LocalDir:    getEnv("STORAGE_LOCAL_DIR", "uploads"),
+			S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("S3_BUCKET", ""),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+			S3PathStyle: getEnvBool("S3_PATH_STYLE", true),
+		},
+		AttachmentMaxSize: int64(getEnvInt("ATTACHMENT_MAX_SIZE_MB", 10)) << 20,
 	}
 }
 
+// minJWTSecretLength is the shortest accepted JWT_SECRET, matching the 256-bit key size of HS256
+const minJWTSecretLength = 32
+
+// Validate rejects settings the server must not start with
+func (c *Config) Validate() error {
+	switch {
+	case c.JWTSecret == "":
+		return fmt.Errorf("JWT_SECRET is not set")
+	case c.JWTSecret == "your-secret-key":
+		return fmt.Errorf("JWT_SECRET is still the placeholder value")
+	case len(c.JWTSecret) < minJWTSecretLength:
+		return fmt.Errorf("JWT_SECRET must be at least %d bytes long", minJWTSecretLength)
+	}
+	return nil
+}
+
+// InitStorage sets up the file storage backend for attachments
+func (c *Config) InitStorage() error {
+	storage, err := utils.NewStorage(c.StorageConfig)
+	if err != nil {
+		return err
+	}
+
+	c.Storage = storage
+	log.Printf("✓ File storage ready (%s)", c.StorageConfig.Driver)
+	return nil
+}
+
 // InitDB initializes database connection
 func (c *Config) InitDB() error {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
 		c.DBHost, c.DBUser, c.DBPass, c.DBName, c.DBPort)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		// Map constraint violations to gorm errors such as gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -63,13 +175,34 @@ func (c *Config) MigrateDB() error {
 
 	log.Printf("🔄 Checking and updating database schema...")
 
+	// Accounts created before email verification existed are treated as verified
+	backfillEmailVerified := c.DB.Migrator().HasTable(&models.User{}) &&
+		!c.DB.Migrator().HasColumn(&models.User{}, "email_verified_at")
+	backfillSessionStart := c.DB.Migrator().HasTable(&models.RefreshToken{}) &&
+		!c.DB.Migrator().HasColumn(&models.RefreshToken{}, "session_started_at")
+
 	// Run AutoMigrate to create/update tables with correct schema (preserves existing data)
 	log.Printf("  - Creating tables with new schema...")
 	if err := c.DB.AutoMigrate(
 		&models.User{},
 		&models.PasswordReset{},
+		&models.RefreshToken{},
+		&models.Invitation{},
+		&models.EmailVerification{},
+		&models.LoginAttempt{},
+		&models.SecurityEvent{},
+		&models.RecoveryCode{},
+		&models.PasswordHistory{},
+		&models.OIDCLoginState{},
+		&models.APIKey{},
 		&models.Product{},
 		&models.Gudang{},
+		&models.Category{},
+		&models.Unit{},
+		&models.ProductUnit{},
+		&models.ProductBarcode{},
+		&models.ProductAttachment{},
+		&models.UserGudang{},
 		&models.Transaction{},
 		&models.StockGudang{},
 		&models.StockCard{},
@@ -78,16 +211,152 @@ func (c *Config) MigrateDB() error {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	if backfillEmailVerified {
+		log.Printf("  - Marking existing users as email verified...")
+		if err := c.DB.Model(&models.User{}).Where("email_verified_at IS NULL").
+			Update("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			return fmt.Errorf("failed to backfill email_verified_at: %w", err)
+		}
+	}
+
+	if backfillSessionStart {
+		log.Printf("  - Backfilling session start times...")
+		if err := c.DB.Model(&models.RefreshToken{}).Where("session_started_at IS NULL").
+			Update("session_started_at", gorm.Expr("created_at")).Error; err != nil {
+			return fmt.Errorf("failed to backfill session_started_at: %w", err)
+		}
+	}
+
+	// Reset tokens used to be stored in plaintext; drop that column so none remain at rest
+	if c.DB.Migrator().HasColumn(&models.PasswordReset{}, "token") {
+		log.Printf("  - Dropping plaintext password reset tokens...")
+		if err := c.DB.Migrator().DropColumn(&models.PasswordReset{}, "token"); err != nil {
+			return fmt.Errorf("failed to drop password_resets.token: %w", err)
+		}
+	}
+
 	// Ensure produk table exists
 	if !c.DB.Migrator().HasTable(&models.Produk{}) {
 		log.Printf("  - Creating produk table...")
 		c.DB.Migrator().CreateTable(&models.Produk{})
 	}
 
+	if !c.DB.Migrator().HasColumn(&models.Produk{}, "kategori_id") {
+		log.Printf("  - Adding produk.kategori_id...")
+		if err := c.DB.Migrator().AddColumn(&models.Produk{}, "KategoriID"); err != nil {
+			return fmt.Errorf("failed to add produk.kategori_id: %w", err)
+		}
+	}
+	if !c.DB.Migrator().HasColumn(&models.Produk{}, "deleted_at") {
+		log.Printf("  - Adding produk.deleted_at...")
+		if err := c.DB.Migrator().AddColumn(&models.Produk{}, "DeletedAt"); err != nil {
+			return fmt.Errorf("failed to add produk.deleted_at: %w", err)
+		}
+	}
+	if err := c.DB.Exec("CREATE INDEX IF NOT EXISTS idx_produk_deleted_at ON produk (deleted_at)").Error; err != nil {
+		return fmt.Errorf("failed to create produk.deleted_at index: %w", err)
+	}
+
+	if err := c.DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_kategori_nama_parent ON kategori (LOWER(nama), COALESCE(parent_id, 0))").Error; err != nil {
+		return fmt.Errorf("failed to create kategori index: %w", err)
+	}
+	if err := c.migrateJenisBarang(); err != nil {
+		return fmt.Errorf("failed to migrate jenis_barang into categories: %w", err)
+	}
+
+	if err := c.DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_satuan_kode ON satuan (LOWER(kode))").Error; err != nil {
+		return fmt.Errorf("failed to create satuan index: %w", err)
+	}
+	// Seed the unit master with the base units already used by products
+	if err := c.DB.Exec(`INSERT INTO satuan (kode, nama, created_at, updated_at)
+		SELECT DISTINCT ON (LOWER(TRIM(satuan))) TRIM(satuan), TRIM(satuan), NOW(), NOW() FROM produk
+		WHERE TRIM(satuan) <> '' AND LOWER(TRIM(satuan)) NOT IN (SELECT LOWER(kode) FROM satuan)
+		ORDER BY LOWER(TRIM(satuan)), TRIM(satuan)`).Error; err != nil {
+		return fmt.Errorf("failed to seed satuan: %w", err)
+	}
+
+	// Indexes for filtering and searching the product list
+	log.Printf("  - Ensuring produk indexes...")
+	for _, stmt := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_produk_jenis_barang ON produk (jenis_barang)",
+		"CREATE INDEX IF NOT EXISTS idx_produk_satuan ON produk (satuan)",
+	} {
+		if err := c.DB.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to create produk index: %w", err)
+		}
+	}
+	// Product codes are unique regardless of case among products that are not deleted;
+	// existing duplicates must be cleaned up first
+	var duplicateCodes int64
+	if err := c.DB.Raw("SELECT COUNT(*) FROM (SELECT 1 FROM produk WHERE deleted_at IS NULL GROUP BY LOWER(kode_barang) HAVING COUNT(*) > 1) d").
+		Scan(&duplicateCodes).Error; err != nil {
+		return fmt.Errorf("failed to check duplicate product codes: %w", err)
+	}
+	// The index used to cover deleted products too, which kept their codes from being reused
+	if err := c.DB.Exec("DROP INDEX IF EXISTS idx_produk_kode_barang_lower").Error; err != nil {
+		return fmt.Errorf("failed to drop old produk.kode_barang index: %w", err)
+	}
+	if duplicateCodes > 0 {
+		log.Printf("⚠️  %d duplicated kode_barang values found, unique index not created; see GET /api/v1/products/duplicates", duplicateCodes)
+	} else if err := c.DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_produk_kode_barang_active ON produk (LOWER(kode_barang)) WHERE deleted_at IS NULL").Error; err != nil {
+		return fmt.Errorf("failed to create unique index on produk.kode_barang: %w", err)
+	}
+
+	// Trigram indexes make ILIKE search fast; without the extension search still works via a sequential scan
+	if err := c.DB.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Printf("⚠️  pg_trgm extension unavailable, product search will not use indexes: %v", err)
+	} else {
+		for _, stmt := range []string{
+			"CREATE INDEX IF NOT EXISTS idx_produk_kode_barang_trgm ON produk USING gin (kode_barang gin_trgm_ops)",
+			"CREATE INDEX IF NOT EXISTS idx_produk_nama_barang_trgm ON produk USING gin (nama_barang gin_trgm_ops)",
+		} {
+			if err := c.DB.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("failed to create produk search index: %w", err)
+			}
+		}
+	}
+
 	log.Printf("✓ Database migrations completed successfully")
 	return nil
 }
 
+// migrateJenisBarang creates a top-level category for every free-text jenis_barang value
+// of uncategorised products and links them. Values differing only in case or surrounding
+// spaces share one category; synonyms such as "ATK" and "Alat Tulis" can be merged afterwards.
+func (c *Config) migrateJenisBarang() error {
+	var values []string
+	if err := c.DB.Model(&models.Produk{}).
+		Where("kategori_id IS NULL AND TRIM(jenis_barang) <> ''").
+		Distinct().Pluck("TRIM(jenis_barang)", &values).Error; err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	log.Printf("  - Migrating %d jenis_barang values into categories...", len(values))
+	return c.DB.Transaction(func(tx *gorm.DB) error {
+		for _, value := range values {
+			var category models.Category
+			err := tx.Where("LOWER(nama) = LOWER(?) AND parent_id IS NULL", value).First(&category).Error
+			if err == gorm.ErrRecordNotFound {
+				category = models.Category{Nama: value}
+				err = tx.Create(&category).Error
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Model(&models.Produk{}).
+				Where("kategori_id IS NULL AND LOWER(TRIM(jenis_barang)) = LOWER(?)", value).
+				Update("kategori_id", category.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // TestConnection tests if database connection is working
 func (c *Config) TestConnection() (bool, error) {
 	if c.DB == nil {
@@ -112,3 +381,41 @@ func getEnv(key, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+		log.Printf("⚠️  Invalid duration for %s: %q, using default %s", key, val, defaultVal)
+	}
+	return defaultVal
+}
+
+func getEnvInt(key string, defaultVal int) int {
+	if val := os.Getenv(key); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+		log.Printf("⚠️  Invalid integer for %s: %q, using default %d", key, val, defaultVal)
+	}
+	return defaultVal
+}
+
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+		log.Printf("⚠️  Invalid boolean for %s: %q, using default %t", key, val, defaultVal)
+	}
+	return defaultVal
+}
+
+func getEnvList(key string, defaultVal []string) []string {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	return strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == ' ' })
+}
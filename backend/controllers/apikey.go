@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"errors"
+	"inventory-backend/middleware"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetAPIKeys returns all API keys (without the secret)
+func GetAPIKeys(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var keys []models.APIKey
+	if err := db.Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  keys,
+		"total": len(keys),
+	})
+}
+
+// CreateAPIKeyRequest holds data for creating an API key
+type CreateAPIKeyRequest struct {
+	Name        string     `json:"name" binding:"required,max=100"`
+	UserID      uint       `json:"user_id"`
+	Permissions []string   `json:"permissions"`
+	GudangIDs   []uint     `json:"gudang_ids"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKey generates a new API key; the plaintext key is only returned once
+func CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	creator, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	// Keys act on behalf of their owner, defaulting to the admin creating them
+	ownerID := req.UserID
+	if ownerID == 0 {
+		ownerID = creator.ID
+	}
+	var owner models.User
+	if err := db.First(&owner, ownerID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Owner user not found"})
+		return
+	}
+
+	for _, permission := range req.Permissions {
+		if !middleware.IsValidPermission(permission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + permission})
+			return
+		}
+	}
+
+	gudangIDs := uniqueIDs(req.GudangIDs)
+	if len(gudangIDs) > 0 {
+		var found int64
+		if err := db.Model(&models.Gudang{}).Where("id IN ?", gudangIDs).Count(&found).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if int(found) != len(gudangIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "One or more gudang_ids do not exist"})
+			return
+		}
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	secret, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	rawKey := middleware.APIKeyPrefix + secret
+
+	key := models.APIKey{
+		Name:        req.Name,
+		Prefix:      rawKey[:len(middleware.APIKeyPrefix)+8],
+		KeyHash:     utils.HashToken(rawKey),
+		UserID:      owner.ID,
+		Permissions: req.Permissions,
+		GudangIDs:   gudangIDs,
+		ExpiresAt:   req.ExpiresAt,
+		CreatedBy:   creator.ID,
+	}
+	if err := db.Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	logSecurityEvent(c, db, EventAPIKeyCreated, owner.ID, owner.Email, map[string]interface{}{
+		"api_key_id":  key.ID,
+		"name":        key.Name,
+		"prefix":      key.Prefix,
+		"permissions": key.Permissions,
+		"gudang_ids":  key.GudangIDs,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key created successfully. Store the key now, it will not be shown again",
+		"key":     rawKey,
+		"data":    key,
+	})
+}
+
+// RevokeAPIKey revokes an API key by ID
+func RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var key models.APIKey
+	if err := db.Select("id", "name", "prefix", "user_id").First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	result := db.Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	logSecurityEvent(c, db, EventAPIKeyRevoked, key.UserID, "", map[string]interface{}{
+		"api_key_id": key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
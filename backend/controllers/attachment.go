@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"inventory-backend/config"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// thumbnailSize is the longest side in pixels of generated image thumbnails
+const thumbnailSize = 256
+
+var attachmentExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// getStorage returns the file storage and the configured upload limit, writing an error response if unavailable
+func getStorage(c *gin.Context) (utils.Storage, int64, bool) {
+	cfgValue, _ := c.Get("config")
+	cfg, ok := cfgValue.(*config.Config)
+	if !ok || cfg.Storage == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "File storage not initialized"})
+		return nil, 0, false
+	}
+	return cfg.Storage, cfg.AttachmentMaxSize, true
+}
+
+// withAttachmentURLs fills in the download links of an attachment
+func withAttachmentURLs(a *models.ProductAttachment) {
+	a.URL = fmt.Sprintf("/api/v1/products/%d/attachments/%d/file", a.ProdukID, a.ID)
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL = a.URL + "?thumbnail=true"
+	}
+}
+
+// loadAttachments returns the attachments of a product, newest first
+func loadAttachments(db *gorm.DB, produkID uint) ([]models.ProductAttachment, error) {
+	var attachments []models.ProductAttachment
+	if err := db.Where("produk_id = ?", produkID).Order("created_at DESC, id DESC").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	for i := range attachments {
+		withAttachmentURLs(&attachments[i])
+	}
+	return attachments, nil
+}
+
+// deleteAttachmentFiles removes stored files; failures only leave orphaned files behind, so they are logged
+func deleteAttachmentFiles(c *gin.Context, storage utils.Storage, attachments ...models.ProductAttachment) {
+	for _, a := range attachments {
+		for _, key := range []string{a.StorageKey, a.ThumbnailKey} {
+			if key == "" {
+				continue
+			}
+			if err := storage.Delete(c.Request.Context(), key); err != nil {
+				log.Printf("Failed to delete attachment file %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// UploadProductAttachment stores a photo or document sent as the multipart field "file"
+func UploadProductAttachment(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	storage, maxSize, ok := getStorage(c)
+	if !ok {
+		return
+	}
+
+	produk, ok := findProduct(c, db)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart framing around the file itself
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds the %d MB limit", maxSize>>20)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Multipart field \"file\" is required"})
+		return
+	}
+	if fileHeader.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds the %d MB limit", maxSize>>20)})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+		return
+	}
+	if int64(len(data)) > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds the %d MB limit", maxSize>>20)})
+		return
+	}
+
+	contentType, kind, err := utils.DetectAttachmentType(data)
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	var thumbnail []byte
+	if kind == utils.AttachmentImage {
+		if thumbnail, err = utils.MakeThumbnail(data, thumbnailSize); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Image could not be processed: " + err.Error()})
+			return
+		}
+	}
+
+	name := strings.TrimSpace(filepath.Base(strings.ReplaceAll(fileHeader.Filename, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		name = "lampiran" + attachmentExtensions[contentType]
+	}
+
+	token, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+		return
+	}
+	attachment := models.ProductAttachment{
+		ProdukID:    produk.ID,
+		Jenis:       kind,
+		NamaFile:    strings.ToValidUTF8(truncate(name, 255), ""),
+		ContentType: contentType,
+		Ukuran:      int64(len(data)),
+		StorageKey:  fmt.Sprintf("produk/%d/%s%s", produk.ID, token, attachmentExtensions[contentType]),
+		UploadedBy:  &user.ID,
+	}
+
+	ctx := c.Request.Context()
+	if err := storage.Put(ctx, attachment.StorageKey, data, contentType); err != nil {
+		log.Printf("Failed to store attachment %s: %v", attachment.StorageKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+		return
+	}
+	if thumbnail != nil {
+		attachment.ThumbnailKey = fmt.Sprintf("produk/%d/%s_thumb.jpg", produk.ID, token)
+		if err := storage.Put(ctx, attachment.ThumbnailKey, thumbnail, "image/jpeg"); err != nil {
+			log.Printf("Failed to store thumbnail %s: %v", attachment.ThumbnailKey, err)
+			attachment.ThumbnailKey = ""
+			deleteAttachmentFiles(c, storage, attachment)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+			return
+		}
+	}
+
+	if err := db.Create(&attachment).Error; err != nil {
+		deleteAttachmentFiles(c, storage, attachment)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+		return
+	}
+	withAttachmentURLs(&attachment)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Attachment uploaded successfully",
+		"data":    attachment,
+	})
+}
+
+// GetProductAttachments lists the attachments of a product
+func GetProductAttachments(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	produk, ok := findProduct(c, db)
+	if !ok {
+		return
+	}
+
+	attachments, err := loadAttachments(db, produk.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  attachments,
+		"total": len(attachments),
+	})
+}
+
+// findAttachment loads an attachment of the product in the :id route parameter
+func findAttachment(c *gin.Context, db *gorm.DB) (*models.ProductAttachment, bool) {
+	produkID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return nil, false
+	}
+	attachmentID, err := strconv.Atoi(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return nil, false
+	}
+
+	var attachment models.ProductAttachment
+	if err := db.Where("id = ? AND produk_id = ?", attachmentID, produkID).First(&attachment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachment"})
+		}
+		return nil, false
+	}
+	return &attachment, true
+}
+
+// DownloadProductAttachment streams an attachment, or its thumbnail with ?thumbnail=true
+func DownloadProductAttachment(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	storage, _, ok := getStorage(c)
+	if !ok {
+		return
+	}
+
+	attachment, ok := findAttachment(c, db)
+	if !ok {
+		return
+	}
+
+	key, contentType, size, name := attachment.StorageKey, attachment.ContentType, attachment.Ukuran, attachment.NamaFile
+	if c.Query("thumbnail") == "true" {
+		if attachment.ThumbnailKey == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment has no thumbnail"})
+			return
+		}
+		key, contentType, size = attachment.ThumbnailKey, "image/jpeg", -1
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + "_thumb.jpg"
+	}
+
+	reader, err := storage.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, utils.ErrFileNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment file is missing from storage"})
+			return
+		}
+		log.Printf("Failed to read attachment %s: %v", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attachment"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, size, contentType, reader, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("inline", map[string]string{"filename": name}),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// DeleteProductAttachment removes an attachment and its stored files
+func DeleteProductAttachment(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	storage, _, ok := getStorage(c)
+	if !ok {
+		return
+	}
+
+	attachment, ok := findAttachment(c, db)
+	if !ok {
+		return
+	}
+
+	if err := db.Delete(attachment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	deleteAttachmentFiles(c, storage, *attachment)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"inventory-backend/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Security event types written to the audit log
+const (
+	EventLoginSuccess           = "login_success"
+	EventLoginFailed            = "login_failed"
+	EventAccountLocked          = "account_locked"
+	EventLogout                 = "logout"
+	EventLogoutAll              = "logout_all"
+	EventPasswordResetRequested = "password_reset_requested"
+	EventPasswordResetCompleted = "password_reset_completed"
+	EventPasswordChanged        = "password_changed"
+	EventUserCreated            = "user_created"
+	EventUserUpdated            = "user_updated"
+	EventRoleChanged            = "role_changed"
+	EventUserDeactivated        = "user_deactivated"
+	EventUserReactivated        = "user_reactivated"
+	EventUserUnlocked           = "user_unlocked"
+	EventPasswordSetEmailSent   = "password_set_email_sent"
+	EventUserGudangsChanged     = "user_gudangs_changed"
+	EventSessionRevoked         = "session_revoked"
+	EventForceLogout            = "force_logout"
+	EventInvitationCreated      = "invitation_created"
+	EventInvitationRevoked      = "invitation_revoked"
+	EventInvitationAccepted     = "invitation_accepted"
+	EventAPIKeyCreated          = "api_key_created"
+	EventAPIKeyRevoked          = "api_key_revoked"
+	EventTwoFactorEnabled       = "two_factor_enabled"
+	EventTwoFactorDisabled      = "two_factor_disabled"
+	EventRecoveryCodesReset     = "recovery_codes_reset"
+)
+
+var securityEventTypes = map[string]bool{
+	EventLoginSuccess:           true,
+	EventLoginFailed:            true,
+	EventAccountLocked:          true,
+	EventLogout:                 true,
+	EventLogoutAll:              true,
+	EventPasswordResetRequested: true,
+	EventPasswordResetCompleted: true,
+	EventPasswordChanged:        true,
+	EventUserCreated:            true,
+	EventUserUpdated:            true,
+	EventRoleChanged:            true,
+	EventUserDeactivated:        true,
+	EventUserReactivated:        true,
+	EventUserUnlocked:           true,
+	EventPasswordSetEmailSent:   true,
+	EventUserGudangsChanged:     true,
+	EventSessionRevoked:         true,
+	EventForceLogout:            true,
+	EventInvitationCreated:      true,
+	EventInvitationRevoked:      true,
+	EventInvitationAccepted:     true,
+	EventAPIKeyCreated:          true,
+	EventAPIKeyRevoked:          true,
+	EventTwoFactorEnabled:       true,
+	EventTwoFactorDisabled:      true,
+	EventRecoveryCodesReset:     true,
+}
+
+// logSecurityEvent records an audit entry for the request. The authenticated user, if any, is stored as the actor.
+// Failures are only logged so that auditing never breaks the request itself.
+func logSecurityEvent(c *gin.Context, db *gorm.DB, eventType string, userID uint, email string, details map[string]interface{}) {
+	event := models.SecurityEvent{
+		EventType: eventType,
+		Email:     email,
+		IPAddress: c.ClientIP(),
+		UserAgent: truncate(c.Request.UserAgent(), 255),
+		Details:   details,
+	}
+	if userID != 0 {
+		event.UserID = &userID
+	}
+	if value, ok := c.Get("user"); ok {
+		if actor, ok := value.(*models.User); ok && actor != nil {
+			event.ActorID = &actor.ID
+		}
+	}
+
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("Failed to record security event %s: %v", eventType, err)
+	}
+}
+
+// GetSecurityEvents returns audit log entries filtered by user, event type and date range
+func GetSecurityEvents(c *gin.Context) {
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	query := db.Model(&models.SecurityEvent{})
+
+	if v := c.Query("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		query = query.Where("user_id = ? OR actor_id = ?", userID, userID)
+	}
+
+	if eventType := c.Query("event_type"); eventType != "" {
+		if !securityEventTypes[eventType] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event_type"})
+			return
+		}
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, _, err := parseDateParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, use YYYY-MM-DD or RFC3339"})
+			return
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+
+	if v := c.Query("to"); v != "" {
+		to, dateOnly, err := parseDateParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, use YYYY-MM-DD or RFC3339"})
+			return
+		}
+		// A plain date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		query = query.Where("created_at < ?", to)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch security events"})
+		return
+	}
+
+	var events []models.SecurityEvent
+	if err := query.Order("created_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch security events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  events,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// parseDateParam accepts a YYYY-MM-DD date in local time or an RFC3339 timestamp
+func parseDateParam(value string) (t time.Time, dateOnly bool, err error) {
+	if t, err = time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
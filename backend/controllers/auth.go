@@ -1,16 +1,19 @@
 package controllers
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"inventory-backend/config"
+	"inventory-backend/middleware"
 	"inventory-backend/models"
+	"inventory-backend/utils"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // LoginRequest holds login credentials
@@ -29,50 +32,141 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+
+	// Block IPs that are guessing passwords across many accounts
+	throttled, err := ipThrottled(cfg, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if throttled {
+		logSecurityEvent(c, cfg.DB, EventLoginFailed, 0, req.Email, map[string]interface{}{"reason": "ip_throttled"})
+		c.Header("Retry-After", retryAfterSeconds(cfg.LoginLockout))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, please try again later"})
+		return
+	}
+
 	// Find user by email
 	var user models.User
 	if err := cfg.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		recordLoginAttempt(cfg.DB, req.Email, ip, false)
+		logSecurityEvent(c, cfg.DB, EventLoginFailed, 0, req.Email, map[string]interface{}{"reason": "unknown_email"})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
+	// Enforce account lockout and progressive delays between failed attempts
+	if wait := loginRetryAfter(&user); wait > 0 {
+		logSecurityEvent(c, cfg.DB, EventLoginFailed, user.ID, user.Email, map[string]interface{}{"reason": "rate_limited"})
+		c.Header("Retry-After", retryAfterSeconds(wait))
+		if isLocked(&user) {
+			c.JSON(http.StatusLocked, gin.H{
+				"error":        "Account is temporarily locked due to too many failed login attempts",
+				"locked_until": user.LockedUntil,
+			})
+			return
+		}
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, please wait before retrying"})
+		return
+	}
+
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		recordLoginAttempt(cfg.DB, req.Email, ip, false)
+		if err := registerFailedLogin(c, cfg, &user); err != nil {
+			log.Printf("Failed to record failed login for user %d: %v", user.ID, err)
+		}
+		logSecurityEvent(c, cfg.DB, EventLoginFailed, user.ID, user.Email, map[string]interface{}{"reason": "invalid_password"})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// TODO: Generate real JWT token
-	// For now, return a mock token
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   "mock-jwt-token-" + user.Email,
-		"user": gin.H{
-			"id":    user.ID,
-			"name":  user.Name,
-			"email": user.Email,
-			"role":  user.Role,
-		},
-	})
+	recordLoginAttempt(cfg.DB, req.Email, ip, true)
+
+	if user.DeactivatedAt != nil {
+		logSecurityEvent(c, cfg.DB, EventLoginFailed, user.ID, user.Email, map[string]interface{}{"reason": "deactivated"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	if cfg.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		logSecurityEvent(c, cfg.DB, EventLoginFailed, user.ID, user.Email, map[string]interface{}{"reason": "email_unverified"})
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                       "Email address has not been verified",
+			"email_verification_required": true,
+		})
+		return
+	}
+
+	// Users with 2FA finish logging in through LoginTwoFactor
+	if user.TOTPEnabled {
+		startTwoFactorChallenge(c, cfg, &user, "password")
+		return
+	}
+
+	if err := registerSuccessfulLogin(cfg.DB, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record login"})
+		return
+	}
+
+	// Start a new session with a short-lived access token and a refresh token
+	response, err := issueTokens(c, cfg.DB, cfg, &user, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	logSecurityEvent(c, cfg.DB, EventLoginSuccess, user.ID, user.Email, map[string]interface{}{"method": "password"})
+
+	response["message"] = "Login successful"
+	response["user"] = gin.H{
+		"id":    user.ID,
+		"name":  user.Name,
+		"email": user.Email,
+		"role":  user.Role,
+	}
+	if cfg.RequireAdmin2FA && user.Role == middleware.RoleAdmin {
+		// Admins without 2FA can only reach the enrollment endpoints until they enable it
+		response["two_factor_setup_required"] = true
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// Logout handles user logout
-func Logout(c *gin.Context) {
-	// With JWT, logout is typically handled client-side by deleting the token
-	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+// currentUser returns the user resolved by middleware.AuthRequired
+func currentUser(c *gin.Context) (*models.User, bool) {
+	value, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil, false
+	}
+
+	user, ok := value.(*models.User)
+	if !ok || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil, false
+	}
+
+	return user, true
 }
 
 // RegisterRequest holds data for user registration
 type RegisterRequest struct {
 	Name     string `json:"name" binding:"required,min=3,max=100"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
-	Role     string `json:"role" binding:"required,oneof=admin staff"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"`
 }
 
-// Register creates a new user without authentication (public endpoint)
+// Register creates a new staff user without authentication (public endpoint).
+// Admin accounts can only be created through invitations.
 func Register(c *gin.Context) {
 	cfg := c.MustGet("config").(*config.Config)
+
+	if cfg.RegistrationMode == "closed" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Self-registration is disabled, ask an admin for an invitation"})
+		return
+	}
 	
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -80,6 +174,11 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	if req.Role != "" && req.Role != "staff" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Self-registration can only create staff accounts"})
+		return
+	}
+
 	// Check if email already exists
 	var existingUser models.User
 	if err := cfg.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
@@ -87,28 +186,49 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	newUser := models.User{
+		Name:  req.Name,
+		Email: req.Email,
+		Role:  "staff",
+	}
+
+	if err := checkNewPassword(cfg.DB, cfg, &newUser, req.Password); err != nil {
+		if !respondPasswordRejected(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate password"})
+		}
+		return
+	}
+
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
+	newUser.Password = hashedPassword
 
 	// Create new user
-	newUser := models.User{
-		Name:     req.Name,
-		Email:    req.Email,
-		Password: string(hashedPassword),
-		Role:     req.Role,
+	err = cfg.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newUser).Error; err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, cfg, newUser.ID, hashedPassword)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
 	}
 
-	if err := cfg.DB.Create(&newUser).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	if err := sendVerificationEmail(cfg, &newUser); err != nil {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "User registered, but the verification email could not be sent",
+			"data":    newUser,
+		})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
+		"message": "User registered successfully, please check your email to verify your address",
 		"data":    newUser,
 	})
 }
@@ -131,7 +251,7 @@ func ForgotPassword(c *gin.Context) {
 
 	// Check if user exists
 	var user models.User
-	if err := cfg.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	if err := cfg.DB.Where("email = ? AND deactivated_at IS NULL", req.Email).First(&user).Error; err != nil {
 		// Don't reveal if email exists or not for security
 		c.JSON(http.StatusOK, gin.H{
 			"message": "If the email exists, a password reset link has been sent",
@@ -139,31 +259,31 @@ func ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	// Generate reset token
-	token, err := generateResetToken()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+	// Limit how many reset emails one address can trigger; respond identically so the limit reveals nothing
+	var recentRequests int64
+	if err := cfg.DB.Model(&models.PasswordReset{}).
+		Where("email = ? AND created_at > ?", user.Email, time.Now().Add(-time.Hour)).
+		Count(&recentRequests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check reset requests"})
 		return
 	}
-
-	// Delete old tokens for this email
-	cfg.DB.Where("email = ? AND used = false", req.Email).Delete(&models.PasswordReset{})
-
-	// Save reset token (expires in 1 hour)
-	resetToken := models.PasswordReset{
-		Email:     req.Email,
-		Token:     token,
-		ExpiresAt: time.Now().Add(1 * time.Hour),
-		Used:      false,
+	if recentRequests >= int64(cfg.PasswordResetMaxPerHour) {
+		logSecurityEvent(c, cfg.DB, EventPasswordResetRequested, user.ID, user.Email, map[string]interface{}{"rate_limited": true})
+		c.JSON(http.StatusOK, gin.H{
+			"message": "If the email exists, a password reset link has been sent",
+		})
+		return
 	}
 
-	if err := cfg.DB.Create(&resetToken).Error; err != nil {
+	// Generate reset token (only its hash is stored)
+	token, resetToken, err := createPasswordResetToken(cfg.DB, user.Email, cfg.PasswordResetExpiry)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reset token"})
 		return
 	}
 
 	// Send email with reset link
-	resetURL := fmt.Sprintf("http://localhost:3000/reset-password?token=%s", token)
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", cfg.FrontendURL, token)
 	emailBody := fmt.Sprintf(`
 <!DOCTYPE html>
 <html>
@@ -201,7 +321,7 @@ func ForgotPassword(c *gin.Context) {
             
             <div class="warning">
                 <strong>⚠️ Security Notice:</strong><br>
-                This link will expire in 1 hour. If you didn't request this reset, please ignore this email or contact support if you have concerns.
+                This link will expire on %s. If you didn't request this reset, please ignore this email or contact support if you have concerns.
             </div>
             
             <p>If the button doesn't work, copy and paste this link into your browser:</p>
@@ -215,13 +335,15 @@ func ForgotPassword(c *gin.Context) {
     </div>
 </body>
 </html>
-`, user.Name, resetURL, resetURL)
+`, user.Name, resetURL, resetToken.ExpiresAt.Format("02 Jan 2006 15:04"), resetURL)
 
 	if err := emailCfg.SendEmail(req.Email, "Password Reset Request - Inventory System", emailBody); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
 		return
 	}
 
+	logSecurityEvent(c, cfg.DB, EventPasswordResetRequested, user.ID, user.Email, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "If the email exists, a password reset link has been sent",
 	})
@@ -230,7 +352,7 @@ func ForgotPassword(c *gin.Context) {
 // ResetPasswordRequest holds data for password reset
 type ResetPasswordRequest struct {
 	Token       string `json:"token" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 // ResetPassword handles password reset with token
@@ -243,45 +365,111 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Find and validate token
-	var resetToken models.PasswordReset
-	if err := cfg.DB.Where("token = ? AND used = false", req.Token).First(&resetToken).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
-		return
-	}
-
-	// Check if token is expired
-	if time.Now().After(resetToken.ExpiresAt) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset token has expired"})
+	// bcrypt cannot hash longer passwords; the rest of the policy is checked once the user is known
+	if len(req.NewPassword) > utils.MaxPasswordBytes {
+		respondPasswordRejected(c, &passwordRejectedError{
+			message:    "Password does not meet the password policy",
+			violations: []string{fmt.Sprintf("must be at most %d bytes long", utils.MaxPasswordBytes)},
+		})
 		return
 	}
 
 	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(req.NewPassword)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
-	// Update user password
-	if err := cfg.DB.Model(&models.User{}).Where("email = ?", resetToken.Email).Update("password", string(hashedPassword)).Error; err != nil {
+	// Consume the token, update the password and end every session atomically
+	var user models.User
+	err = cfg.DB.Transaction(func(tx *gorm.DB) error {
+		var resetToken models.PasswordReset
+		if err := tx.Where("token_hash = ? AND used = false AND expires_at > ?", utils.HashToken(req.Token), time.Now()).
+			First(&resetToken).Error; err != nil {
+			return errInvalidResetToken
+		}
+
+		// Mark token as used; a concurrent reset with the same token loses here
+		result := tx.Model(&models.PasswordReset{}).Where("id = ? AND used = false", resetToken.ID).Update("used", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+
+		if err := tx.Where("email = ?", resetToken.Email).First(&user).Error; err != nil {
+			return errInvalidResetToken
+		}
+
+		// Rejecting the password rolls back the token so the user can try again
+		if err := checkNewPassword(tx, cfg, &user, req.NewPassword); err != nil {
+			return err
+		}
+
+		// A successful reset also clears any login lockout
+		updates := map[string]interface{}{
+			"password":           hashedPassword,
+			"failed_login_count": 0,
+			"locked_until":       nil,
+		}
+		// Receiving the reset link proves ownership of the email address
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = time.Now()
+		}
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := recordPasswordHistory(tx, cfg, user.ID, hashedPassword); err != nil {
+			return err
+		}
+
+		return revokeAllSessions(tx, user.ID)
+	})
+	if errors.Is(err, errInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if respondPasswordRejected(c, err) {
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
-	// Mark token as used
-	cfg.DB.Model(&resetToken).Update("used", true)
+	logSecurityEvent(c, cfg.DB, EventPasswordResetCompleted, user.ID, user.Email, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Password has been reset successfully",
 	})
 }
 
-// generateResetToken generates a secure random token
-func generateResetToken() (string, error) {
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+var errInvalidResetToken = errors.New("invalid reset token")
+
+// createPasswordResetToken invalidates earlier unused tokens for the email and stores the hash of a new one.
+// It returns the plaintext token to put in the emailed link.
+func createPasswordResetToken(db *gorm.DB, email string, ttl time.Duration) (string, *models.PasswordReset, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Old tokens are marked used rather than deleted so they still count towards the rate limit
+	if err := db.Model(&models.PasswordReset{}).Where("email = ? AND used = false", email).Update("used", true).Error; err != nil {
+		return "", nil, err
 	}
-	return hex.EncodeToString(bytes), nil
+
+	resetToken := models.PasswordReset{
+		Email:     email,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+		Used:      false,
+	}
+	if err := db.Create(&resetToken).Error; err != nil {
+		return "", nil, err
+	}
+
+	return token, &resetToken, nil
 }
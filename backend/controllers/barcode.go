@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"errors"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// findBarcode looks up the barcode record for a scanned code
+func findBarcode(db *gorm.DB, code string) (*models.ProductBarcode, error) {
+	var barcode models.ProductBarcode
+	if err := db.Preload("Satuan").Where("kode IN ?", utils.BarcodeLookupCandidates(code)).Order("LENGTH(kode) ASC").First(&barcode).Error; err != nil {
+		return nil, err
+	}
+	return &barcode, nil
+}
+
+// GetProductByBarcode resolves a scanned barcode to its product
+func GetProductByBarcode(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	barcode, err := findBarcode(db, c.Param("code"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No product has this barcode"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up barcode"})
+		return
+	}
+
+	var produk models.Produk
+	if err := db.First(&produk, barcode.ProdukID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    produk,
+		"barcode": barcode,
+	})
+}
+
+// GetProductBarcodes lists the barcodes of a product
+func GetProductBarcodes(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	produk, ok := findProduct(c, db)
+	if !ok {
+		return
+	}
+
+	var barcodes []models.ProductBarcode
+	if err := db.Preload("Satuan").Where("produk_id = ?", produk.ID).Order("id ASC").Find(&barcodes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch barcodes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  barcodes,
+		"total": len(barcodes),
+	})
+}
+
+// AddProductBarcodeRequest holds data for attaching a barcode to a product
+type AddProductBarcodeRequest struct {
+	Kode     string `json:"kode"` // may be empty for jenis internal to generate one
+	Jenis    string `json:"jenis" binding:"required,oneof=ean13 code128 internal"`
+	SatuanID *uint  `json:"satuan_id"` // optional packaging unit the barcode is printed on
+}
+
+// AddProductBarcode attaches a barcode to a product
+func AddProductBarcode(c *gin.Context) {
+	var req AddProductBarcodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	produk, ok := findProduct(c, db)
+	if !ok {
+		return
+	}
+
+	if req.Jenis == utils.BarcodeInternal && strings.TrimSpace(req.Kode) == "" {
+		req.Kode = utils.InternalEAN13(produk.ID)
+	}
+	kode, err := utils.NormalizeBarcode(req.Jenis, req.Kode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	barcode := models.ProductBarcode{ProdukID: produk.ID, Kode: kode, Jenis: req.Jenis}
+
+	// The barcode's unit must be one the product can be counted in
+	if req.SatuanID != nil {
+		var unit models.Unit
+		if err := db.First(&unit, *req.SatuanID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unit not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch unit"})
+			return
+		}
+		if _, err := productUnitFactor(db, produk, unit.Kode); err != nil {
+			if errors.Is(err, errUnknownUnit) {
+				respondUnknownUnit(c, produk, unit.Kode)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		barcode.SatuanID = &unit.ID
+		barcode.Satuan = &unit
+	}
+
+	var existing models.ProductBarcode
+	err = db.Where("kode = ?", kode).First(&existing).Error
+	if err == nil {
+		respondBarcodeConflict(c, &existing)
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check barcode"})
+		return
+	}
+
+	if err := db.Omit("Satuan").Create(&barcode).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			if db.Where("kode = ?", kode).First(&existing).Error == nil {
+				respondBarcodeConflict(c, &existing)
+				return
+			}
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add barcode"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Barcode added successfully",
+		"data":    barcode,
+	})
+}
+
+// respondBarcodeConflict writes the 409 response for a barcode that is already assigned
+func respondBarcodeConflict(c *gin.Context, existing *models.ProductBarcode) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error": "Barcode " + strconv.Quote(existing.Kode) + " is already assigned",
+		"conflict": gin.H{
+			"id":        existing.ID,
+			"produk_id": existing.ProdukID,
+			"kode":      existing.Kode,
+		},
+	})
+}
+
+// DeleteProductBarcode removes a barcode from a product
+func DeleteProductBarcode(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	produk, ok := findProduct(c, db)
+	if !ok {
+		return
+	}
+
+	barcodeID, err := strconv.Atoi(c.Param("barcodeId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid barcode ID"})
+		return
+	}
+
+	result := db.Where("id = ? AND produk_id = ?", barcodeID, produk.ID).Delete(&models.ProductBarcode{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete barcode"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Barcode not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Barcode deleted successfully"})
+}
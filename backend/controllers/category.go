@@ -0,0 +1,574 @@
+package controllers
+
+import (
+	"errors"
+	"inventory-backend/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// categoryNode is a category with its children and rolled-up figures
+type categoryNode struct {
+	models.Category
+	ProductCount int64           `json:"product_count"`
+	TotalStock   *int64          `json:"total_stock,omitempty"`
+	OwnStock     *int64          `json:"own_stock,omitempty"`
+	Children     []*categoryNode `json:"children"`
+}
+
+// categorySubtreeIDs returns the ID of a category and all of its descendants
+func categorySubtreeIDs(db *gorm.DB, id uint) ([]uint, error) {
+	var ids []uint
+	err := db.Raw(`
+WITH RECURSIVE tree AS (
+	SELECT id FROM kategori WHERE id = ?
+	UNION ALL
+	SELECT k.id FROM kategori k JOIN tree t ON k.parent_id = t.id
+)
+SELECT id FROM tree`, id).Scan(&ids).Error
+	return ids, err
+}
+
+// categoryFilterIDs reads the kategori_id query parameter and expands it to the category subtree,
+// unless include_subcategories=false. It writes an error response and returns ok=false on failure.
+func categoryFilterIDs(c *gin.Context, db *gorm.DB) (ids []uint, filtered, ok bool) {
+	value := c.Query("kategori_id")
+	if value == "" {
+		return nil, false, true
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid kategori_id"})
+		return nil, false, false
+	}
+
+	if c.Query("include_subcategories") == "false" {
+		return []uint{uint(id)}, true, true
+	}
+
+	ids, err = categorySubtreeIDs(db, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve category"})
+		return nil, false, false
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return nil, false, false
+	}
+	return ids, true, true
+}
+
+// buildCategoryTree links categories into a forest. If rootID is non-zero only that subtree is returned.
+func buildCategoryTree(categories []models.Category, rootID uint) []*categoryNode {
+	nodes := make(map[uint]*categoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &categoryNode{Category: category, Children: []*categoryNode{}}
+	}
+
+	roots := []*categoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	if rootID != 0 {
+		if node, ok := nodes[rootID]; ok {
+			return []*categoryNode{node}
+		}
+		return []*categoryNode{}
+	}
+	return roots
+}
+
+// rollUp adds each node's own figures to those of its descendants
+func rollUp(node *categoryNode, ownCounts, ownStock map[uint]int64, withStock bool) {
+	node.ProductCount = ownCounts[node.ID]
+	if withStock {
+		own, total := ownStock[node.ID], ownStock[node.ID]
+		node.OwnStock = &own
+		node.TotalStock = &total
+	}
+
+	for _, child := range node.Children {
+		rollUp(child, ownCounts, ownStock, withStock)
+		node.ProductCount += child.ProductCount
+		if withStock {
+			*node.TotalStock += *child.TotalStock
+		}
+	}
+}
+
+// countProductsByCategory returns the number of products directly in each category
+func countProductsByCategory(db *gorm.DB) (map[uint]int64, error) {
+	var rows []struct {
+		KategoriID uint
+		Count      int64
+	}
+	if err := db.Model(&models.Produk{}).
+		Select("kategori_id, COUNT(*) AS count").
+		Where("kategori_id IS NOT NULL").
+		Group("kategori_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.KategoriID] = row.Count
+	}
+	return counts, nil
+}
+
+// findCategory loads a category by the :id route parameter, writing an error response if it fails
+func findCategory(c *gin.Context, db *gorm.DB) (*models.Category, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return nil, false
+	}
+
+	var category models.Category
+	if err := db.First(&category, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category"})
+		}
+		return nil, false
+	}
+
+	return &category, true
+}
+
+// validateCategoryParent checks that parentID exists and is not the category itself or one of its descendants
+func validateCategoryParent(c *gin.Context, db *gorm.DB, categoryID uint, parentID *uint) bool {
+	if parentID == nil {
+		return true
+	}
+
+	var parent models.Category
+	if err := db.First(&parent, *parentID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+		return false
+	}
+
+	if categoryID == 0 {
+		return true
+	}
+
+	subtree, err := categorySubtreeIDs(db, categoryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate parent category"})
+		return false
+	}
+	for _, id := range subtree {
+		if id == *parentID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A category cannot be moved under itself or one of its subcategories"})
+			return false
+		}
+	}
+	return true
+}
+
+// ensureUniqueCategoryName checks that no sibling has the same name, ignoring case
+func ensureUniqueCategoryName(c *gin.Context, db *gorm.DB, nama string, parentID *uint, excludeID uint) bool {
+	query := db.Where("LOWER(nama) = LOWER(?) AND id <> ?", nama, excludeID)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	var existing models.Category
+	err := query.First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check category name"})
+		return false
+	}
+
+	c.JSON(http.StatusConflict, gin.H{
+		"error":    "A category with this name already exists at this level",
+		"conflict": existing,
+	})
+	return false
+}
+
+// GetCategories returns all categories as a flat list, or as a tree with rolled-up product counts when tree=true
+func GetCategories(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var categories []models.Category
+	if err := db.Order("nama ASC").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	if c.Query("tree") != "true" {
+		c.JSON(http.StatusOK, gin.H{
+			"data":  categories,
+			"total": len(categories),
+		})
+		return
+	}
+
+	counts, err := countProductsByCategory(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	roots := buildCategoryTree(categories, 0)
+	for _, root := range roots {
+		rollUp(root, counts, nil, false)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  roots,
+		"total": len(categories),
+	})
+}
+
+// GetCategory returns a category with its subtree and rolled-up product count
+func GetCategory(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	category, ok := findCategory(c, db)
+	if !ok {
+		return
+	}
+
+	var categories []models.Category
+	if err := db.Order("nama ASC").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category"})
+		return
+	}
+	counts, err := countProductsByCategory(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category"})
+		return
+	}
+
+	roots := buildCategoryTree(categories, category.ID)
+	rollUp(roots[0], counts, nil, false)
+
+	c.JSON(http.StatusOK, gin.H{"data": roots[0]})
+}
+
+// CategoryRequest holds data for creating or updating a category
+type CategoryRequest struct {
+	Nama     string `json:"nama" binding:"required,max=100"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+// CreateCategory creates a category, optionally under a parent
+func CreateCategory(c *gin.Context) {
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nama := strings.TrimSpace(req.Nama)
+	if nama == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nama is required"})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	if !validateCategoryParent(c, db, 0, req.ParentID) || !ensureUniqueCategoryName(c, db, nama, req.ParentID, 0) {
+		return
+	}
+
+	category := models.Category{Nama: nama, ParentID: req.ParentID}
+	if err := db.Create(&category).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A category with this name already exists at this level"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Category created successfully",
+		"data":    category,
+	})
+}
+
+// UpdateCategory renames a category and/or moves it under another parent (null parent_id makes it top-level)
+func UpdateCategory(c *gin.Context) {
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nama := strings.TrimSpace(req.Nama)
+	if nama == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nama is required"})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	category, ok := findCategory(c, db)
+	if !ok {
+		return
+	}
+
+	if !validateCategoryParent(c, db, category.ID, req.ParentID) || !ensureUniqueCategoryName(c, db, nama, req.ParentID, category.ID) {
+		return
+	}
+
+	category.Nama = nama
+	category.ParentID = req.ParentID
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(category).Updates(map[string]interface{}{
+			"nama":      category.Nama,
+			"parent_id": category.ParentID,
+		}).Error; err != nil {
+			return err
+		}
+		// Keep the legacy jenis_barang text in line with the category name
+		return tx.Unscoped().Model(&models.Produk{}).Where("kategori_id = ?", category.ID).Update("jenis_barang", category.Nama).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A category with this name already exists at this level"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Category updated successfully",
+		"data":    category,
+	})
+}
+
+// DeleteCategory removes a category that has no subcategories and no products
+func DeleteCategory(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	category, ok := findCategory(c, db)
+	if !ok {
+		return
+	}
+
+	var children, products int64
+	if err := db.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+	if err := db.Model(&models.Produk{}).Where("kategori_id = ?", category.ID).Count(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+	if children > 0 || products > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "Category still has subcategories or products, move or merge them first",
+			"subcategories": children,
+			"product_count": products,
+		})
+		return
+	}
+
+	if err := db.Delete(category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// MergeCategoryRequest holds the category that absorbs the merged one
+type MergeCategoryRequest struct {
+	TargetID uint `json:"target_id" binding:"required"`
+}
+
+// MergeCategory moves all products and subcategories of a category into the target and deletes it,
+// e.g. to fold "Alat Tulis" into "ATK"
+func MergeCategory(c *gin.Context) {
+	var req MergeCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	source, ok := findCategory(c, db)
+	if !ok {
+		return
+	}
+
+	var target models.Category
+	if err := db.First(&target, req.TargetID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target category not found"})
+		return
+	}
+
+	subtree, err := categorySubtreeIDs(db, source.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge categories"})
+		return
+	}
+	for _, id := range subtree {
+		if id == target.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A category cannot be merged into itself or one of its subcategories"})
+			return
+		}
+	}
+
+	var moved int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&models.Produk{}).Where("kategori_id = ?", source.ID).Updates(map[string]interface{}{
+			"kategori_id":  target.ID,
+			"jenis_barang": target.Nama,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		moved = result.RowsAffected
+
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", source.ID).Update("parent_id", target.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(source).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The target already has a subcategory with the same name as one being moved"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Categories merged successfully",
+		"data":           target,
+		"products_moved": moved,
+	})
+}
+
+// GetStockByCategory returns stock totals per category, rolled up from subcategories into their parents
+func GetStockByCategory(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var rootID uint
+	if v := c.Query("kategori_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid kategori_id"})
+			return
+		}
+		rootID = uint(id)
+	}
+
+	gudangIDs, allGudangs, err := gudangScope(c, db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	stockQuery := restrictToGudangs(db.Model(&models.StockGudang{}), "stok_gudang.gudang_id", gudangIDs, allGudangs)
+	if v := c.Query("gudang_id"); v != "" {
+		gudangID, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gudang_id"})
+			return
+		}
+		if !requireGudangAccess(c, db, uint(gudangID)) {
+			return
+		}
+		stockQuery = stockQuery.Where("stok_gudang.gudang_id = ?", gudangID)
+	}
+
+	var rows []struct {
+		KategoriID uint
+		Total      int64
+	}
+	if err := stockQuery.
+		Select("produk.kategori_id, COALESCE(SUM(stok_gudang.jumlah), 0) AS total").
+		Joins("JOIN produk ON produk.id = stok_gudang.produk_id").
+		Where("produk.kategori_id IS NOT NULL AND produk.deleted_at IS NULL").
+		Group("produk.kategori_id").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate stock"})
+		return
+	}
+	ownStock := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		ownStock[row.KategoriID] = row.Total
+	}
+
+	counts, err := countProductsByCategory(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate stock"})
+		return
+	}
+
+	var categories []models.Category
+	if err := db.Order("nama ASC").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	roots := buildCategoryTree(categories, rootID)
+	if rootID != 0 && len(roots) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	for _, root := range roots {
+		rollUp(root, counts, ownStock, true)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  roots,
+		"total": len(roots),
+	})
+}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"inventory-backend/middleware"
+	"inventory-backend/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// gudangScope returns the warehouse IDs the current request may access.
+// all is true for admins, who may access every warehouse. Requests made with an
+// API key are further limited to the key's gudang scope.
+func gudangScope(c *gin.Context, db *gorm.DB, user *models.User) (ids []uint, all bool, err error) {
+	if user.Role == middleware.RoleAdmin {
+		all = true
+	} else {
+		ids = []uint{}
+		if err = db.Model(&models.UserGudang{}).Where("user_id = ?", user.ID).Pluck("gudang_id", &ids).Error; err != nil {
+			return nil, false, err
+		}
+	}
+
+	if value, ok := c.Get("api_key"); ok {
+		if key, ok := value.(*models.APIKey); ok && len(key.GudangIDs) > 0 {
+			if all {
+				return key.GudangIDs, false, nil
+			}
+			return intersectIDs(ids, key.GudangIDs), false, nil
+		}
+	}
+
+	return ids, all, nil
+}
+
+// canAccessGudang reports whether the current request may see or move stock in a warehouse
+func canAccessGudang(c *gin.Context, db *gorm.DB, user *models.User, gudangID uint) (bool, error) {
+	ids, all, err := gudangScope(c, db, user)
+	if err != nil || all {
+		return all, err
+	}
+
+	for _, id := range ids {
+		if id == gudangID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// requireGudangAccess writes a 403 response and returns false if the current user cannot access the warehouse
+func requireGudangAccess(c *gin.Context, db *gorm.DB, gudangID uint) bool {
+	user, ok := currentUser(c)
+	if !ok {
+		return false
+	}
+
+	allowed, err := canAccessGudang(c, db, user, gudangID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not assigned to this gudang"})
+		return false
+	}
+	return true
+}
+
+// restrictToGudangs limits a query to the given warehouse column unless all warehouses are allowed
+func restrictToGudangs(query *gorm.DB, column string, ids []uint, all bool) *gorm.DB {
+	if all {
+		return query
+	}
+	return query.Where(column+" IN ?", ids)
+}
+
+// GetUserGudangs returns the warehouses assigned to a user
+func GetUserGudangs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var gudangs []models.Gudang
+	if err := db.Joins("JOIN user_gudang ON user_gudang.gudang_id = gudang.id").
+		Where("user_gudang.user_id = ?", id).
+		Order("gudang.id ASC").
+		Find(&gudangs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  gudangs,
+		"total": len(gudangs),
+	})
+}
+
+// SetUserGudangsRequest holds the full list of warehouses assigned to a user
+type SetUserGudangsRequest struct {
+	GudangIDs []uint `json:"gudang_ids" binding:"required"`
+}
+
+// SetUserGudangs replaces the warehouse assignments of a user
+func SetUserGudangs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req SetUserGudangsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if len(req.GudangIDs) > 0 {
+		var found int64
+		if err := db.Model(&models.Gudang{}).Where("id IN ?", req.GudangIDs).Count(&found).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if int(found) != len(uniqueIDs(req.GudangIDs)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "One or more gudang_ids do not exist"})
+			return
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserGudang{}).Error; err != nil {
+			return err
+		}
+		for _, gudangID := range uniqueIDs(req.GudangIDs) {
+			if err := tx.Create(&models.UserGudang{UserID: user.ID, GudangID: gudangID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update warehouse assignments"})
+		return
+	}
+
+	logSecurityEvent(c, db, EventUserGudangsChanged, user.ID, user.Email, map[string]interface{}{"gudang_ids": uniqueIDs(req.GudangIDs)})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Warehouse assignments updated successfully",
+		"data": gin.H{
+			"user_id":    user.ID,
+			"gudang_ids": uniqueIDs(req.GudangIDs),
+		},
+	})
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func intersectIDs(a, b []uint) []uint {
+	inB := make(map[uint]bool, len(b))
+	for _, id := range b {
+		inB[id] = true
+	}
+	result := []uint{}
+	for _, id := range a {
+		if inB[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
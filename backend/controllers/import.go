@@ -0,0 +1,451 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Limits of a single product import
+const (
+	maxImportFileSize = 10 << 20
+	maxImportRows     = 5000
+)
+
+// importColumns maps header names, normalized to lower snake case, to the CreateProductRequest field they fill
+var importColumns = map[string]string{
+	"kode_barang":  "kode_barang",
+	"kode":         "kode_barang",
+	"sku":          "kode_barang",
+	"nama_barang":  "nama_barang",
+	"nama":         "nama_barang",
+	"jenis_barang": "jenis_barang",
+	"jenis":        "jenis_barang",
+	"kategori":     "jenis_barang",
+	"kategori_id":  "kategori_id",
+	"satuan":       "satuan",
+	"unit":         "satuan",
+	"stok_minimal": "stok_minimal",
+	"stok_min":     "stok_minimal",
+	"berat_kg":     "berat_kg",
+	"berat":        "berat_kg",
+}
+
+// importRowResult is the validation outcome of one spreadsheet row
+type importRowResult struct {
+	Row        int      `json:"row"`
+	KodeBarang string   `json:"kode_barang"`
+	Action     string   `json:"action"` // create, update or invalid
+	ProdukID   *uint    `json:"produk_id,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+
+	product models.Produk
+}
+
+// ImportProducts creates products from an uploaded CSV or XLSX file (multipart field "file").
+// With dry_run=true only the per-row validation report is returned; with upsert=true rows whose
+// kode_barang already exists update that product instead of being rejected. Nothing is saved
+// unless every row is valid, and all rows are written in one transaction.
+func ImportProducts(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+	upsert := c.Query("upsert") == "true"
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds the %d MB limit", maxImportFileSize>>20)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Multipart field \"file\" is required"})
+		return
+	}
+	if fileHeader.Size > maxImportFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds the %d MB limit", maxImportFileSize>>20)})
+		return
+	}
+
+	// An optional JSON object maps custom headers to fields, e.g. {"Nama Produk": "nama_barang"}
+	mapping := map[string]string{}
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of column header to field"})
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxImportFileSize+1))
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+
+	rows, err := utils.ReadSpreadsheet(data, maxImportRows+1)
+	if errors.Is(err, utils.ErrTooManyRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d products can be imported at once", maxImportRows)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rows) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File needs a header row and at least one product row"})
+		return
+	}
+
+	columns, ignored, err := mapImportColumns(rows[0].Cells, mapping, upsert)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := validateImportRows(db, rows[1:], columns, upsert)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate import"})
+		return
+	}
+
+	report := gin.H{
+		"dry_run":         dryRun,
+		"upsert":          upsert,
+		"ignored_columns": ignored,
+		"rows":            results,
+	}
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Action]++
+	}
+	report["total"] = len(results)
+	report["created"] = counts["create"]
+	report["updated"] = counts["update"]
+	report["invalid"] = counts["invalid"]
+
+	if dryRun {
+		report["valid"] = counts["invalid"] == 0
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	if counts["invalid"] > 0 {
+		report["error"] = "Import has invalid rows, nothing was saved"
+		c.JSON(http.StatusUnprocessableEntity, report)
+		return
+	}
+
+	var failed *importRowResult
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i := range results {
+			r := &results[i]
+			failed = r
+			if r.Action == "create" {
+				if err := tx.Create(&r.product).Error; err != nil {
+					return err
+				}
+				r.ProdukID = &r.product.ID
+				continue
+			}
+			// Explicit columns so a product deleted since validation is not brought back
+			result := tx.Model(&models.Produk{ID: r.product.ID}).
+				Select("kode_barang", "nama_barang", "jenis_barang", "kategori_id", "satuan", "stok_minimal", "berat_kg").
+				Updates(&r.product)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrDuplicatedKey):
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Row %d: product code %q was taken while importing, nothing was saved", failed.Row, failed.KodeBarang)})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Row %d: product %q was deleted while importing, nothing was saved", failed.Row, failed.KodeBarang)})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import products"})
+		}
+		return
+	}
+
+	report["message"] = "Products imported successfully"
+	c.JSON(http.StatusOK, report)
+}
+
+// mapImportColumns resolves the header row to a field -> column index map and lists the ignored headers
+func mapImportColumns(header []string, mapping map[string]string, upsert bool) (map[string]int, []string, error) {
+	custom := make(map[string]string, len(mapping))
+	for name, field := range mapping {
+		if importColumns[field] != field {
+			return nil, nil, fmt.Errorf("mapping for %q: unknown field %q", name, field)
+		}
+		custom[normalizeImportHeader(name)] = field
+	}
+
+	columns := map[string]int{}
+	ignored := []string{}
+	for i, name := range header {
+		key := normalizeImportHeader(name)
+		field, ok := custom[key]
+		if !ok {
+			field, ok = importColumns[key]
+		}
+		if !ok {
+			if key != "" {
+				ignored = append(ignored, strings.TrimSpace(name))
+			}
+			continue
+		}
+		if prev, dup := columns[field]; dup {
+			return nil, nil, fmt.Errorf("columns %q and %q both map to %s", strings.TrimSpace(header[prev]), strings.TrimSpace(name), field)
+		}
+		columns[field] = i
+	}
+
+	required := []string{"kode_barang"}
+	if !upsert {
+		// Updates may leave these out, new products cannot
+		required = append(required, "nama_barang", "satuan")
+	}
+	var missing []string
+	for _, field := range required {
+		if _, ok := columns[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("missing required column(s): %s", strings.Join(missing, ", "))
+	}
+	return columns, ignored, nil
+}
+
+// normalizeImportHeader turns "Kode Barang" or "kode-barang" into "kode_barang"
+func normalizeImportHeader(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_' || r == '.'
+	}), "_")
+}
+
+// validateImportRows checks every row and decides whether it creates or updates a product.
+// Only database failures are returned as an error; row problems are reported in the results.
+func validateImportRows(db *gorm.DB, rows []utils.SpreadsheetRow, columns map[string]int, upsert bool) ([]importRowResult, error) {
+	// Look up the existing products in chunks to stay well below the bind parameter limit
+	var codes []string
+	for _, row := range rows {
+		if code := importCell(row, columns, "kode_barang"); code != "" {
+			codes = append(codes, strings.ToLower(code))
+		}
+	}
+	existing := map[string]models.Produk{}
+	for start := 0; start < len(codes); start += 1000 {
+		end := min(start+1000, len(codes))
+		var found []models.Produk
+		if err := db.Where("LOWER(kode_barang) IN ?", codes[start:end]).Order("id ASC").Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range found {
+			key := strings.ToLower(p.KodeBarang)
+			if _, ok := existing[key]; !ok {
+				existing[key] = p
+			}
+		}
+	}
+
+	// Products whose base unit is still used by stock or conversions cannot switch units
+	var existingIDs []uint
+	for _, p := range existing {
+		existingIDs = append(existingIDs, p.ID)
+	}
+	unitLocked := map[uint]bool{}
+	for start := 0; start < len(existingIDs); start += 1000 {
+		ids := existingIDs[start:min(start+1000, len(existingIDs))]
+		var stocked, converted []uint
+		if err := db.Model(&models.StockGudang{}).Where("produk_id IN ? AND jumlah <> 0", ids).Distinct().Pluck("produk_id", &stocked).Error; err != nil {
+			return nil, err
+		}
+		if err := db.Model(&models.ProductUnit{}).Where("produk_id IN ?", ids).Distinct().Pluck("produk_id", &converted).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range append(stocked, converted...) {
+			unitLocked[id] = true
+		}
+	}
+
+	var unitList []models.Unit
+	if err := db.Find(&unitList).Error; err != nil {
+		return nil, err
+	}
+	units := make(map[string]string, len(unitList))
+	for _, u := range unitList {
+		units[strings.ToLower(u.Kode)] = u.Kode
+	}
+
+	type categoryResult struct {
+		category *models.Category
+		err      error
+	}
+	categories := map[string]categoryResult{}
+
+	seen := map[string]int{}
+	results := make([]importRowResult, 0, len(rows))
+	for _, row := range rows {
+		r := importRowResult{Row: row.Line, Action: "create"}
+		addError := func(format string, args ...interface{}) {
+			r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+		}
+
+		r.KodeBarang = importCell(row, columns, "kode_barang")
+		nama := importCell(row, columns, "nama_barang")
+		jenis := importCell(row, columns, "jenis_barang")
+		satuan := importCell(row, columns, "satuan")
+
+		key := strings.ToLower(r.KodeBarang)
+		current, exists := existing[key]
+		switch {
+		case r.KodeBarang == "":
+			addError("kode_barang is required")
+		case utf8.RuneCountInString(r.KodeBarang) > 100:
+			addError("kode_barang is longer than 100 characters")
+		case seen[key] != 0:
+			addError("kode_barang %q is repeated from row %d", r.KodeBarang, seen[key])
+		case exists && !upsert:
+			addError("kode_barang %q is already used by product %d", current.KodeBarang, current.ID)
+		}
+		if r.KodeBarang != "" && seen[key] == 0 {
+			seen[key] = row.Line
+		}
+
+		var product models.Produk
+		if exists && upsert {
+			r.Action = "update"
+			r.ProdukID = &current.ID
+			product = current
+		}
+		product.KodeBarang = r.KodeBarang
+
+		if r.Action == "create" {
+			if nama == "" {
+				addError("nama_barang is required")
+			}
+			if satuan == "" {
+				addError("satuan is required")
+			}
+		}
+		if nama != "" {
+			if utf8.RuneCountInString(nama) > 255 {
+				addError("nama_barang is longer than 255 characters")
+			}
+			product.NamaBarang = nama
+		}
+		if satuan != "" {
+			kode, ok := units[strings.ToLower(satuan)]
+			switch {
+			case !ok:
+				addError("satuan %q does not exist in the unit master", satuan)
+			case r.Action == "update" && !strings.EqualFold(kode, strings.TrimSpace(current.Satuan)) && unitLocked[current.ID]:
+				addError("satuan cannot change from %q while stock or unit conversions are recorded in it", current.Satuan)
+			default:
+				product.Satuan = kode
+			}
+		}
+		if jenis != "" && utf8.RuneCountInString(jenis) > 100 {
+			addError("jenis_barang is longer than 100 characters")
+		}
+
+		if v := importCell(row, columns, "stok_minimal"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				addError("stok_minimal %q must be a whole number of at least 0", v)
+			}
+			product.StokMinimal = n
+		}
+		if v := importCell(row, columns, "berat_kg"); v != "" {
+			// Accept decimal commas as written in Indonesian spreadsheets
+			if !strings.Contains(v, ".") {
+				v = strings.Replace(v, ",", ".", 1)
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 {
+				addError("berat_kg %q must be a number of at least 0", v)
+			}
+			product.BeratKg = f
+		}
+
+		var kategoriID *uint
+		if v := importCell(row, columns, "kategori_id"); v != "" {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || id == 0 {
+				addError("kategori_id %q is not a valid ID", v)
+			} else {
+				u := uint(id)
+				kategoriID = &u
+			}
+		}
+		if kategoriID != nil || jenis != "" {
+			cacheKey := "nama:" + strings.ToLower(jenis)
+			if kategoriID != nil {
+				cacheKey = fmt.Sprintf("id:%d", *kategoriID)
+			}
+			res, ok := categories[cacheKey]
+			if !ok {
+				res.category, res.err = findProductCategory(db, kategoriID, jenis)
+				categories[cacheKey] = res
+			}
+			switch {
+			case errors.Is(res.err, errCategoryNotFound):
+				addError("kategori_id %d not found", *kategoriID)
+			case res.err != nil:
+				return nil, res.err
+			case res.category != nil:
+				product.KategoriID = &res.category.ID
+				product.JenisBarang = res.category.Nama
+			default:
+				product.KategoriID = nil
+				product.JenisBarang = jenis
+			}
+		} else if r.Action == "create" {
+			addError("kategori_id or jenis_barang is required")
+		}
+
+		if len(r.Errors) > 0 {
+			r.Action = "invalid"
+			r.ProdukID = nil
+		}
+		r.product = product
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// importCell returns the trimmed value of a mapped column, or "" when the column or cell is absent
+func importCell(row utils.SpreadsheetRow, columns map[string]int, field string) string {
+	i, ok := columns[field]
+	if !ok || i >= len(row.Cells) {
+		return ""
+	}
+	return strings.TrimSpace(row.Cells[i])
+}
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"inventory-backend/config"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateInvitationRequest holds data for inviting a new user
+type CreateInvitationRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Role     string `json:"role" binding:"required,oneof=admin staff"`
+	GudangID *uint  `json:"gudang_id"`
+}
+
+// CreateInvitation creates a one-time invite and emails the acceptance link
+func CreateInvitation(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+	emailCfg := config.LoadEmailConfig()
+
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inviter, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	// Check if email already belongs to an account
+	var existingUser models.User
+	if err := cfg.DB.Where("LOWER(email) = ?", email).First(&existingUser).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+
+	if req.GudangID != nil {
+		var gudang models.Gudang
+		if err := cfg.DB.First(&gudang, *req.GudangID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gudang not found"})
+			return
+		}
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation token"})
+		return
+	}
+
+	// Replace any pending invite for this email so only the latest link works
+	cfg.DB.Where("email = ? AND accepted_at IS NULL", email).Delete(&models.Invitation{})
+
+	invitation := models.Invitation{
+		Email:     email,
+		Role:      req.Role,
+		GudangID:  req.GudangID,
+		TokenHash: utils.HashToken(token),
+		InvitedBy: inviter.ID,
+		ExpiresAt: time.Now().Add(cfg.InviteExpiry),
+	}
+	if err := cfg.DB.Create(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+	logSecurityEvent(c, cfg.DB, EventInvitationCreated, 0, email, map[string]interface{}{
+		"invitation_id": invitation.ID,
+		"role":          invitation.Role,
+		"gudang_id":     invitation.GudangID,
+	})
+
+	inviteURL := fmt.Sprintf("%s/accept-invite?token=%s", cfg.FrontendURL, token)
+	emailBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f8fafc; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 40px; border-radius: 10px;">
+        <h1 style="color: #1e293b; font-size: 24px;">You're invited to the Inventory System</h1>
+        <p style="color: #475569; line-height: 1.6;"><strong>%s</strong> has invited you to join as <strong>%s</strong>. Click the button below to set your password and activate your account:</p>
+        <div style="text-align: center;">
+            <a href="%s" style="display: inline-block; padding: 14px 32px; background-color: #2563eb; color: white; text-decoration: none; border-radius: 8px; font-weight: bold; margin: 20px 0;">Accept Invitation</a>
+        </div>
+        <p style="color: #475569;">This link can be used once and expires on %s.</p>
+        <p style="word-break: break-all; color: #2563eb; font-size: 12px;">%s</p>
+    </div>
+</body>
+</html>
+`, inviter.Name, invitation.Role, inviteURL, invitation.ExpiresAt.Format("02 Jan 2006 15:04"), inviteURL)
+
+	if err := emailCfg.SendEmail(email, "Invitation - Inventory System", emailBody); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Invitation sent successfully",
+		"data":    invitation,
+	})
+}
+
+// GetInvitations returns all pending invitations
+func GetInvitations(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var invitations []models.Invitation
+	if err := db.Where("accepted_at IS NULL").Order("created_at DESC").Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  invitations,
+		"total": len(invitations),
+	})
+}
+
+// DeleteInvitation revokes a pending invitation
+func DeleteInvitation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	result := db.Where("accepted_at IS NULL").Delete(&models.Invitation{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete invitation"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	logSecurityEvent(c, db, EventInvitationRevoked, 0, "", map[string]interface{}{"invitation_id": id})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+// AcceptInvitationRequest holds data for accepting an invitation
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Name     string `json:"name" binding:"required,min=3,max=100"`
+	Password string `json:"password" binding:"required"`
+}
+
+var errInvitationUsed = errors.New("invitation already accepted")
+
+// AcceptInvitation creates the invited account with the chosen password (public endpoint)
+func AcceptInvitation(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var invitation models.Invitation
+	if err := cfg.DB.Where("token_hash = ? AND accepted_at IS NULL", utils.HashToken(req.Token)).First(&invitation).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+
+	if time.Now().After(invitation.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation has expired"})
+		return
+	}
+
+	// The invite link was delivered to this address, so it is already verified
+	now := time.Now()
+	newUser := models.User{
+		Name:            req.Name,
+		Email:           invitation.Email,
+		Role:            invitation.Role,
+		EmailVerifiedAt: &now,
+	}
+
+	if err := checkNewPassword(cfg.DB, cfg, &newUser, req.Password); err != nil {
+		if !respondPasswordRejected(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate password"})
+		}
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	newUser.Password = hashedPassword
+
+	err = cfg.DB.Transaction(func(tx *gorm.DB) error {
+		// Claim the invitation first so a concurrent accept cannot create a second account
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvitationUsed
+		}
+
+		if err := tx.Create(&newUser).Error; err != nil {
+			return err
+		}
+		if err := recordPasswordHistory(tx, cfg, newUser.ID, hashedPassword); err != nil {
+			return err
+		}
+
+		if invitation.GudangID != nil {
+			return tx.Create(&models.UserGudang{UserID: newUser.ID, GudangID: *invitation.GudangID}).Error
+		}
+		return nil
+	})
+	if errors.Is(err, errInvitationUsed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	logSecurityEvent(c, cfg.DB, EventInvitationAccepted, newUser.ID, newUser.Email, map[string]interface{}{
+		"invitation_id": invitation.ID,
+		"role":          newUser.Role,
+		"invited_by":    invitation.InvitedBy,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Invitation accepted, account created successfully",
+		"data":    newUser,
+	})
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxLabelsPerRequest bounds the work of a single render, copies included
+const maxLabelsPerRequest = 1000
+
+// LabelRequest selects the products to print labels for and how to render them
+type LabelRequest struct {
+	ProdukIDs []uint            `json:"produk_ids" binding:"required,min=1"`
+	Format    string            `json:"format" binding:"omitempty,oneof=png pdf zpl"`   // default pdf
+	Symbology string            `json:"symbology" binding:"omitempty,oneof=code128 qr"` // default code128
+	Copies    int               `json:"copies" binding:"omitempty,min=1,max=100"`
+	GudangID  *uint             `json:"gudang_id"` // prints the warehouse name, for shelf and bin labels
+	DPI       int               `json:"dpi" binding:"omitempty,oneof=203 300 600"`
+	Layout    utils.LabelLayout `json:"layout"`
+}
+
+// PrintProductLabels renders labels for one or many products as a PNG, a PDF sheet or ZPL
+func PrintProductLabels(c *gin.Context) {
+	var req LabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	renderLabels(c, db, req)
+}
+
+// GetProductLabel renders the label of a single product, by default as PNG
+func GetProductLabel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	req := LabelRequest{
+		ProdukIDs: []uint{uint(id)},
+		Format:    c.DefaultQuery("format", "png"),
+		Symbology: c.Query("symbology"),
+	}
+	if req.Format != "png" && req.Format != "pdf" && req.Format != "zpl" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be png, pdf or zpl"})
+		return
+	}
+	if req.Symbology != "" && req.Symbology != utils.LabelCode128 && req.Symbology != utils.LabelQR {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbology must be code128 or qr"})
+		return
+	}
+	if v := c.Query("gudang_id"); v != "" {
+		gudangID, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gudang_id"})
+			return
+		}
+		g := uint(gudangID)
+		req.GudangID = &g
+	}
+	if v := c.Query("dpi"); v != "" {
+		if req.DPI, err = strconv.Atoi(v); err != nil || (req.DPI != 203 && req.DPI != 300 && req.DPI != 600) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dpi must be 203, 300 or 600"})
+			return
+		}
+	}
+	for param, target := range map[string]*float64{
+		"label_width_mm":  &req.Layout.LabelWidthMM,
+		"label_height_mm": &req.Layout.LabelHeightMM,
+	} {
+		if v := c.Query(param); v != "" {
+			if *target, err = strconv.ParseFloat(v, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+		}
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	renderLabels(c, db, req)
+}
+
+// renderLabels loads the requested products and writes the rendered labels as the response
+func renderLabels(c *gin.Context, db *gorm.DB, req LabelRequest) {
+	if req.Format == "" {
+		req.Format = "pdf"
+	}
+	if req.Symbology == "" {
+		req.Symbology = utils.LabelCode128
+	}
+	if req.Copies == 0 {
+		req.Copies = 1
+	}
+	if req.DPI == 0 {
+		req.DPI = 300
+		if req.Format == "zpl" {
+			req.DPI = 203
+		}
+	}
+
+	if req.Format == "png" && (len(req.ProdukIDs) != 1 || req.Copies != 1) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PNG output holds a single label; use pdf or zpl for several"})
+		return
+	}
+	if len(req.ProdukIDs)*req.Copies > maxLabelsPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d labels can be printed at once", maxLabelsPerRequest)})
+		return
+	}
+
+	layout := req.Layout.WithDefaults()
+	if err := layout.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var products []models.Produk
+	if err := db.Where("id IN ?", req.ProdukIDs).Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+	byID := make(map[uint]models.Produk, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	var missing []uint
+	for _, id := range req.ProdukIDs {
+		if _, ok := byID[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found", "produk_ids": missing})
+		return
+	}
+
+	var gudangName string
+	if req.GudangID != nil {
+		if !requireGudangAccess(c, db, *req.GudangID) {
+			return
+		}
+		var gudang models.Gudang
+		if err := db.First(&gudang, *req.GudangID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Gudang not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gudang"})
+			return
+		}
+		gudangName = gudang.Nama
+	}
+
+	// Labels come out in request order, copies of a product next to each other
+	contents := make([]utils.LabelContent, 0, len(req.ProdukIDs)*req.Copies)
+	for _, id := range req.ProdukIDs {
+		produk := byID[id]
+		content := utils.LabelContent{
+			Payload: strings.TrimSpace(produk.KodeBarang),
+			Title:   produk.NamaBarang,
+			Details: []string{strings.TrimSpace(produk.KodeBarang), produk.Satuan},
+		}
+		if gudangName != "" {
+			content.Details = append(content.Details, gudangName)
+		}
+		if err := utils.ValidateLabelPayload(req.Symbology, content.Payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     fmt.Sprintf("kode_barang %q cannot be encoded as %s: %v", produk.KodeBarang, req.Symbology, err),
+				"produk_id": produk.ID,
+			})
+			return
+		}
+		for i := 0; i < req.Copies; i++ {
+			contents = append(contents, content)
+		}
+	}
+
+	filename := "labels"
+	if len(req.ProdukIDs) == 1 {
+		filename = "label-" + strconv.FormatUint(uint64(req.ProdukIDs[0]), 10)
+	}
+
+	switch req.Format {
+	case "png":
+		data, err := utils.RenderLabelPNG(contents[0], layout, req.Symbology, req.DPI)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render label"})
+			return
+		}
+		c.Header("Content-Disposition", `inline; filename="`+filename+`.png"`)
+		c.Data(http.StatusOK, "image/png", data)
+	case "pdf":
+		data, err := utils.RenderLabelPDF(contents, layout, req.Symbology)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render labels"})
+			return
+		}
+		c.Header("Content-Disposition", `inline; filename="`+filename+`.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", data)
+	case "zpl":
+		data, err := utils.RenderLabelZPL(contents, layout, req.Symbology, req.DPI)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render labels"})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.zpl"`)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(data))
+	}
+}
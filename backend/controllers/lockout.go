@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"inventory-backend/config"
+	"inventory-backend/models"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loginDelayFreeAttempts is the number of failures allowed before progressive delays kick in
+const loginDelayFreeAttempts = 2
+
+// loginDelayMax caps the progressive delay between attempts on one account
+const loginDelayMax = 60 * time.Second
+
+// ipThrottled reports whether an IP has exceeded the failed-attempt budget within the lockout window
+func ipThrottled(cfg *config.Config, ip string) (bool, error) {
+	var failures int64
+	err := cfg.DB.Model(&models.LoginAttempt{}).
+		Where("ip_address = ? AND success = false AND created_at > ?", ip, time.Now().Add(-cfg.LoginLockout)).
+		Count(&failures).Error
+	return failures >= int64(cfg.LoginMaxIPAttempts), err
+}
+
+// recordLoginAttempt stores an attempt for per-IP throttling
+func recordLoginAttempt(db *gorm.DB, email, ip string, success bool) {
+	db.Create(&models.LoginAttempt{Email: email, IPAddress: ip, Success: success})
+}
+
+// loginRetryAfter returns how long the account must wait before the next attempt, or zero if it may try now.
+// Locked accounts wait until the lock expires; otherwise each failure past the free attempts doubles the delay.
+func loginRetryAfter(user *models.User) time.Duration {
+	now := time.Now()
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return user.LockedUntil.Sub(now)
+	}
+
+	if user.LastFailedLoginAt == nil || user.FailedLoginCount <= loginDelayFreeAttempts {
+		return 0
+	}
+
+	exponent := float64(user.FailedLoginCount - loginDelayFreeAttempts - 1)
+	delay := time.Duration(math.Min(math.Pow(2, exponent), loginDelayMax.Seconds())) * time.Second
+	if wait := user.LastFailedLoginAt.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// isLocked reports whether the account is currently locked out
+func isLocked(user *models.User) bool {
+	return user.LockedUntil != nil && time.Now().Before(*user.LockedUntil)
+}
+
+// registerFailedLogin increments the failure counter and locks the account once the limit is reached.
+// The counter is incremented in the database so parallel guesses cannot all read the same count.
+func registerFailedLogin(c *gin.Context, cfg *config.Config, user *models.User) error {
+	now := time.Now()
+
+	// A lock that has expired starts a fresh count
+	var counter struct {
+		FailedLoginCount int
+		LockedUntil      *time.Time
+	}
+	err := cfg.DB.Raw(`UPDATE users SET
+			failed_login_count = CASE WHEN locked_until IS NOT NULL AND locked_until <= ? THEN 1 ELSE failed_login_count + 1 END,
+			locked_until = CASE WHEN locked_until IS NOT NULL AND locked_until <= ? THEN NULL ELSE locked_until END,
+			last_failed_login_at = ?
+		WHERE id = ?
+		RETURNING failed_login_count, locked_until`, now, now, now, user.ID).Scan(&counter).Error
+	if err != nil {
+		return err
+	}
+	user.FailedLoginCount = counter.FailedLoginCount
+	user.LockedUntil = counter.LockedUntil
+	user.LastFailedLoginAt = &now
+
+	if user.FailedLoginCount < cfg.LoginMaxAttempts || user.LockedUntil != nil {
+		return nil
+	}
+
+	// Only the request that sets the lock logs it
+	lockedUntil := now.Add(cfg.LoginLockout)
+	result := cfg.DB.Model(&models.User{}).Where("id = ? AND locked_until IS NULL", user.ID).Update("locked_until", lockedUntil)
+	if result.Error != nil {
+		return result.Error
+	}
+	user.LockedUntil = &lockedUntil
+	if result.RowsAffected > 0 {
+		logSecurityEvent(c, cfg.DB, EventAccountLocked, user.ID, user.Email, map[string]interface{}{
+			"failed_login_count": user.FailedLoginCount,
+			"locked_until":       lockedUntil,
+		})
+	}
+	return nil
+}
+
+// registerSuccessfulLogin clears the failure counter and records the login time
+func registerSuccessfulLogin(db *gorm.DB, user *models.User) error {
+	now := time.Now()
+	user.LastLoginAt = &now
+	user.FailedLoginCount = 0
+	user.LockedUntil = nil
+
+	return db.Model(user).Updates(map[string]interface{}{
+		"last_login_at":      user.LastLoginAt,
+		"failed_login_count": 0,
+		"locked_until":       nil,
+	}).Error
+}
+
+// retryAfterSeconds formats a wait duration for the Retry-After header
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// UnlockUser clears the lockout and failed-attempt counter of an account
+func UnlockUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	result := db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"failed_login_count": 0,
+		"locked_until":       nil,
+	})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	logSecurityEvent(c, db, EventUserUnlocked, uint(id), "", nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
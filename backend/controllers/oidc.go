@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"errors"
+	"inventory-backend/config"
+	"inventory-backend/middleware"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// oidcLoginExpiry is how long a user has to complete the login at the identity provider
+const oidcLoginExpiry = 10 * time.Minute
+
+var (
+	errOIDCNotAllowed  = errors.New("identity is not in an allowed group")
+	errOIDCNoAccount   = errors.New("no account exists for this identity")
+	errOIDCLinkedOther = errors.New("account is linked to a different identity")
+	errOIDCUnverified  = errors.New("email address is not verified at the identity provider")
+)
+
+// OIDCLogin starts a single sign-on login and returns the identity provider URL to redirect to
+func OIDCLogin(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	if !cfg.OIDC.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	provider, err := utils.GetOIDCProvider(c.Request.Context(), cfg.OIDC)
+	if err != nil {
+		log.Printf("OIDC provider unavailable: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	nonce, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	verifier, challenge, err := utils.GeneratePKCEVerifier()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	// Abandoned logins are cleaned up whenever a new one starts
+	cfg.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+
+	loginState := models.OIDCLoginState{
+		StateHash:    utils.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcLoginExpiry),
+	}
+	if err := cfg.DB.Create(&loginState).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"authorization_url": provider.AuthCodeURL(state, nonce, challenge),
+			"state":             state,
+			"expires_at":        loginState.ExpiresAt,
+		},
+	})
+}
+
+// OIDCCallbackRequest holds the parameters the identity provider redirected back with
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// OIDCCallback completes a single sign-on login and starts a session
+func OIDCCallback(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	if !cfg.OIDC.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The state is single-use; deleting it first stops a replayed callback
+	var loginState models.OIDCLoginState
+	if err := cfg.DB.Where("state_hash = ?", utils.HashToken(req.State)).First(&loginState).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+	result := cfg.DB.Delete(&models.OIDCLoginState{}, loginState.ID)
+	if result.Error != nil || result.RowsAffected == 0 || time.Now().After(loginState.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	provider, err := utils.GetOIDCProvider(c.Request.Context(), cfg.OIDC)
+	if err != nil {
+		log.Printf("OIDC provider unavailable: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), req.Code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Single sign-on failed"})
+		return
+	}
+
+	subject, _ := claims["sub"].(string)
+	email, _ := claims[cfg.OIDC.EmailClaim].(string)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if subject == "" || email == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider did not return a subject and email"})
+		return
+	}
+	// Without a verified email only an identity already linked by subject can sign in
+	emailVerified, _ := claims["email_verified"].(bool)
+	emailVerified = emailVerified || cfg.OIDC.TrustUnverifiedEmail
+
+	user, err := resolveOIDCUser(c, cfg, claims, subject, email, emailVerified)
+	switch {
+	case errors.Is(err, errOIDCNotAllowed), errors.Is(err, errOIDCNoAccount), errors.Is(err, errOIDCLinkedOther),
+		errors.Is(err, errOIDCUnverified):
+		logSecurityEvent(c, cfg.DB, EventLoginFailed, 0, email, map[string]interface{}{"method": "oidc", "reason": err.Error()})
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve account"})
+		return
+	}
+
+	recordLoginAttempt(cfg.DB, email, c.ClientIP(), true)
+
+	if user.DeactivatedAt != nil {
+		logSecurityEvent(c, cfg.DB, EventLoginFailed, user.ID, user.Email, map[string]interface{}{"method": "oidc", "reason": "deactivated"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	// Users with 2FA still enter their code unless the identity provider's MFA is trusted
+	if user.TOTPEnabled && !cfg.OIDC.TrustIdPMFA {
+		startTwoFactorChallenge(c, cfg, user, "oidc")
+		return
+	}
+
+	if err := registerSuccessfulLogin(cfg.DB, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record login"})
+		return
+	}
+
+	response, err := issueTokens(c, cfg.DB, cfg, user, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	logSecurityEvent(c, cfg.DB, EventLoginSuccess, user.ID, user.Email, map[string]interface{}{"method": "oidc"})
+
+	response["message"] = "Login successful"
+	response["user"] = gin.H{
+		"id":    user.ID,
+		"name":  user.Name,
+		"email": user.Email,
+		"role":  user.Role,
+	}
+	if cfg.RequireAdmin2FA && user.Role == middleware.RoleAdmin && !user.TOTPEnabled {
+		response["two_factor_setup_required"] = true
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// resolveOIDCUser finds the account for an SSO identity, linking it by email or provisioning it if allowed.
+// Linking and provisioning by email require a verified email. When admin groups are configured the role
+// is kept in sync with the identity provider on every login.
+func resolveOIDCUser(c *gin.Context, cfg *config.Config, claims jwt.MapClaims, subject, email string, emailVerified bool) (*models.User, error) {
+	role, allowed := oidcRole(cfg.OIDC, oidcGroups(claims[cfg.OIDC.GroupsClaim]))
+	if !allowed {
+		return nil, errOIDCNotAllowed
+	}
+
+	var user models.User
+	err := cfg.DB.Where("oidc_subject = ?", subject).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !emailVerified {
+			return nil, errOIDCUnverified
+		}
+		err = cfg.DB.Where("LOWER(email) = ?", email).First(&user).Error
+		if err == nil && user.OIDCSubject != nil {
+			return nil, errOIDCLinkedOther
+		}
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !cfg.OIDC.AutoProvision {
+			return nil, errOIDCNoAccount
+		}
+
+		// The empty password hash never matches, so provisioned accounts can only sign in through SSO
+		now := time.Now()
+		user = models.User{
+			Name:            oidcName(claims, email),
+			Email:           email,
+			Role:            role,
+			EmailVerifiedAt: &now,
+			OIDCSubject:     &subject,
+		}
+		if err := cfg.DB.Create(&user).Error; err != nil {
+			return nil, err
+		}
+		logSecurityEvent(c, cfg.DB, EventUserCreated, user.ID, user.Email, map[string]interface{}{"role": user.Role, "method": "oidc"})
+		return &user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if user.OIDCSubject == nil {
+		user.OIDCSubject = &subject
+		updates["oidc_subject"] = subject
+	}
+	if user.EmailVerifiedAt == nil && emailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		updates["email_verified_at"] = now
+	}
+	oldRole := user.Role
+	if len(cfg.OIDC.AdminGroups) > 0 && user.Role != role {
+		user.Role = role
+		updates["role"] = role
+	}
+	if len(updates) > 0 {
+		if err := cfg.DB.Model(&user).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	if user.Role != oldRole {
+		logSecurityEvent(c, cfg.DB, EventRoleChanged, user.ID, user.Email, map[string]interface{}{"old_role": oldRole, "new_role": user.Role, "method": "oidc"})
+	}
+
+	return &user, nil
+}
+
+// oidcRole maps identity provider groups onto a role
+func oidcRole(cfg utils.OIDCConfig, groups []string) (string, bool) {
+	if containsAny(groups, cfg.AdminGroups) {
+		return middleware.RoleAdmin, true
+	}
+	if len(cfg.StaffGroups) == 0 || containsAny(groups, cfg.StaffGroups) {
+		return middleware.RoleStaff, true
+	}
+	return "", false
+}
+
+// oidcGroups reads a groups claim, which providers send as either a list or a single string
+func oidcGroups(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		groups := make([]string, 0, len(v))
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// oidcName picks a display name for a provisioned account
+func oidcName(claims jwt.MapClaims, email string) string {
+	for _, key := range []string{"name", "preferred_username"} {
+		if name, _ := claims[key].(string); strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name)
+		}
+	}
+	return email
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, v := range values {
+		for _, c := range candidates {
+			if v == c {
+				return true
+			}
+		}
+	}
+	return false
+}
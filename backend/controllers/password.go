@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"errors"
+	"inventory-backend/config"
+	"inventory-backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// passwordRejectedError is returned when a new password fails the policy or history check
+type passwordRejectedError struct {
+	message    string
+	violations []string
+}
+
+func (e *passwordRejectedError) Error() string {
+	return e.message
+}
+
+// checkNewPassword validates a password against the configured policy and, for existing users,
+// rejects any of their last PasswordPolicy.HistorySize passwords
+func checkNewPassword(db *gorm.DB, cfg *config.Config, user *models.User, password string) error {
+	policy := cfg.PasswordPolicy
+	if violations := policy.Validate(password, user.Email, user.Name); len(violations) > 0 {
+		return &passwordRejectedError{message: "Password does not meet the password policy", violations: violations}
+	}
+
+	if user.ID == 0 || policy.HistorySize <= 0 {
+		return nil
+	}
+
+	var hashes []string
+	if err := db.Model(&models.PasswordHistory{}).
+		Where("user_id = ?", user.ID).
+		Order("id DESC").
+		Limit(policy.HistorySize).
+		Pluck("password_hash", &hashes).Error; err != nil {
+		return err
+	}
+	// Accounts created before password history existed only have their current hash
+	if user.Password != "" {
+		hashes = append(hashes, user.Password)
+	}
+
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return &passwordRejectedError{message: "Password was used recently, please choose a different one"}
+		}
+	}
+	return nil
+}
+
+// hashPassword hashes a password with bcrypt
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hashed), err
+}
+
+// recordPasswordHistory stores a newly set password hash and trims history beyond the policy size
+func recordPasswordHistory(db *gorm.DB, cfg *config.Config, userID uint, hash string) error {
+	if cfg.PasswordPolicy.HistorySize <= 0 {
+		return nil
+	}
+
+	if err := db.Create(&models.PasswordHistory{UserID: userID, PasswordHash: hash}).Error; err != nil {
+		return err
+	}
+
+	keep := db.Model(&models.PasswordHistory{}).
+		Select("id").
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(cfg.PasswordPolicy.HistorySize)
+	return db.Where("user_id = ? AND id NOT IN (?)", userID, keep).Delete(&models.PasswordHistory{}).Error
+}
+
+// respondPasswordRejected writes a 400 response if err is a rejected password and reports whether it did
+func respondPasswordRejected(c *gin.Context, err error) bool {
+	var rejected *passwordRejectedError
+	if !errors.As(err, &rejected) {
+		return false
+	}
+
+	response := gin.H{"error": rejected.message}
+	if len(rejected.violations) > 0 {
+		response["details"] = rejected.violations
+	}
+	c.JSON(http.StatusBadRequest, response)
+	return true
+}
@@ -1,11 +1,15 @@
 package controllers
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"inventory-backend/config"
 	"inventory-backend/models"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -27,23 +31,186 @@ func getDB(c *gin.Context) (*gorm.DB, bool) {
 	return cfg.DB, true
 }
 
-// GetProducts returns all products
+// productSortColumns are the columns GetProducts can sort by
+var productSortColumns = map[string]bool{
+	"id":           true,
+	"kode_barang":  true,
+	"nama_barang":  true,
+	"jenis_barang": true,
+	"satuan":       true,
+	"stok_minimal": true,
+	"berat_kg":     true,
+}
+
+// productCursor marks the last row of a page for keyset pagination
+type productCursor struct {
+	Value interface{} `json:"v"`
+	ID    uint        `json:"id"`
+}
+
+// GetProducts returns products with pagination, sorting, filters and search.
+// Passing cursor switches from page/limit to keyset pagination, which stays fast on deep pages.
 func GetProducts(c *gin.Context) {
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
 	db, ok := getDB(c)
 	if !ok {
 		return
 	}
 
+	sortColumn := c.DefaultQuery("sort", "id")
+	if !productSortColumns[sortColumn] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort column"})
+		return
+	}
+	order := strings.ToLower(c.DefaultQuery("order", "asc"))
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order, must be asc or desc"})
+		return
+	}
+
+	query, ok := withDeleted(c, db.Model(&models.Produk{}))
+	if !ok {
+		return
+	}
+
+	if v := c.Query("jenis_barang"); v != "" {
+		query = query.Where("jenis_barang IN ?", splitList(v))
+	}
+	if v := c.Query("satuan"); v != "" {
+		query = query.Where("satuan IN ?", splitList(v))
+	}
+	categoryIDs, byCategory, ok := categoryFilterIDs(c, db)
+	if !ok {
+		return
+	}
+	if byCategory {
+		query = query.Where("kategori_id IN ?", categoryIDs)
+	}
+
+	// Backed by trigram indexes on kode_barang and nama_barang
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		like := "%" + escapeLike(search) + "%"
+		query = query.Where("kode_barang ILIKE ? OR nama_barang ILIKE ?", like, like)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+
+	_, useCursor := c.GetQuery("cursor")
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeProductCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		op := ">"
+		if order == "desc" {
+			op = "<"
+		}
+		// The id tie-breaker keeps the order stable when sort values repeat
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", sortColumn, op), cursor.Value, cursor.ID)
+	} else if !useCursor {
+		query = query.Offset((page - 1) * limit)
+	}
+
+	// Fetch one extra row to know whether another page follows
 	var items []models.Produk
-	if err := db.Order("id ASC").Find(&items).Error; err != nil {
+	if err := query.Order(sortColumn + " " + order).Order("id " + order).Limit(limit + 1).Find(&items).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":  items,
-		"total": len(items),
-	})
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+
+	var nextCursor *string
+	if hasMore {
+		encoded, err := encodeProductCursor(items[len(items)-1], sortColumn)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+			return
+		}
+		nextCursor = &encoded
+	}
+
+	response := gin.H{
+		"data":        items,
+		"total":       total,
+		"limit":       limit,
+		"has_more":    hasMore,
+		"next_cursor": nextCursor,
+	}
+	if !useCursor {
+		response["page"] = page
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func encodeProductCursor(item models.Produk, sortColumn string) (string, error) {
+	var value interface{}
+	switch sortColumn {
+	case "id":
+		value = item.ID
+	case "kode_barang":
+		value = item.KodeBarang
+	case "nama_barang":
+		value = item.NamaBarang
+	case "jenis_barang":
+		value = item.JenisBarang
+	case "satuan":
+		value = item.Satuan
+	case "stok_minimal":
+		value = item.StokMinimal
+	case "berat_kg":
+		value = item.BeratKg
+	}
+
+	data, err := json.Marshal(productCursor{Value: value, ID: item.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeProductCursor(raw string) (*productCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor productCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.Value == nil {
+		return nil, errors.New("cursor has no value")
+	}
+	return &cursor, nil
+}
+
+// splitList splits a comma separated query value into trimmed, non-empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
 }
 
 // GetProduct returns a single product by ID
@@ -59,8 +226,13 @@ func GetProduct(c *gin.Context) {
 		return
 	}
 
+	scoped, ok := withDeleted(c, db)
+	if !ok {
+		return
+	}
+
 	var item models.Produk
-	if err := db.First(&item, id).Error; err != nil {
+	if err := scoped.First(&item, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
@@ -69,14 +241,34 @@ func GetProduct(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": item})
+	var barcodes []models.ProductBarcode
+	if err := db.Preload("Satuan").Where("produk_id = ?", item.ID).Order("id ASC").Find(&barcodes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+
+	attachments, err := loadAttachments(db, item.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": productDetail{Produk: item, Barcodes: barcodes, Attachments: attachments}})
+}
+
+// productDetail is a product together with the records that hang off it
+type productDetail struct {
+	models.Produk
+	Barcodes    []models.ProductBarcode    `json:"barcodes"`
+	Attachments []models.ProductAttachment `json:"attachments"`
 }
 
 // CreateProductRequest holds data for creating a product
 type CreateProductRequest struct {
 	KodeBarang  string  `json:"kode_barang" binding:"required"`
 	NamaBarang  string  `json:"nama_barang" binding:"required"`
-	JenisBarang string  `json:"jenis_barang" binding:"required"`
+	JenisBarang string  `json:"jenis_barang"`
+	KategoriID  *uint   `json:"kategori_id"`
 	Satuan      string  `json:"satuan" binding:"required"`
 	StokMinimal int     `json:"stok_minimal"`
 	BeratKg     float64 `json:"berat_kg"`
@@ -95,15 +287,46 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
+	kodeBarang := strings.TrimSpace(req.KodeBarang)
+	if kodeBarang == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kode_barang is required"})
+		return
+	}
+	if !ensureUniqueKodeBarang(c, db, kodeBarang, 0) {
+		return
+	}
+
+	category, ok := resolveProductCategory(c, db, req.KategoriID, req.JenisBarang)
+	if !ok {
+		return
+	}
+	if category == nil && strings.TrimSpace(req.JenisBarang) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kategori_id or jenis_barang is required"})
+		return
+	}
+
+	satuan, ok := resolveBaseUnit(c, db, req.Satuan)
+	if !ok {
+		return
+	}
+
 	newProduct := models.Produk{
-		KodeBarang:  req.KodeBarang,
+		KodeBarang:  kodeBarang,
 		NamaBarang:  req.NamaBarang,
-		JenisBarang: req.JenisBarang,
-		Satuan:      req.Satuan,
+		JenisBarang: strings.TrimSpace(req.JenisBarang),
+		Satuan:      satuan,
 		StokMinimal: req.StokMinimal,
 		BeratKg:     req.BeratKg,
 	}
+	if category != nil {
+		newProduct.KategoriID = &category.ID
+		newProduct.JenisBarang = category.Nama
+	}
 	if err := db.Create(&newProduct).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			respondKodeBarangConflict(c, db, kodeBarang, 0)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
 		return
 	}
@@ -119,6 +342,7 @@ type UpdateProductRequest struct {
 	KodeBarang  string  `json:"kode_barang"`
 	NamaBarang  string  `json:"nama_barang"`
 	JenisBarang string  `json:"jenis_barang"`
+	KategoriID  *uint   `json:"kategori_id"`
 	Satuan      string  `json:"satuan"`
 	StokMinimal *int    `json:"stok_minimal"`
 	BeratKg     *float64 `json:"berat_kg"`
@@ -153,17 +377,37 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	if req.KodeBarang != "" {
-		item.KodeBarang = req.KodeBarang
+	if kodeBarang := strings.TrimSpace(req.KodeBarang); kodeBarang != "" {
+		if !strings.EqualFold(kodeBarang, item.KodeBarang) && !ensureUniqueKodeBarang(c, db, kodeBarang, item.ID) {
+			return
+		}
+		item.KodeBarang = kodeBarang
 	}
 	if req.NamaBarang != "" {
 		item.NamaBarang = req.NamaBarang
 	}
-	if req.JenisBarang != "" {
-		item.JenisBarang = req.JenisBarang
+	if req.KategoriID != nil || req.JenisBarang != "" {
+		category, ok := resolveProductCategory(c, db, req.KategoriID, req.JenisBarang)
+		if !ok {
+			return
+		}
+		if category != nil {
+			item.KategoriID = &category.ID
+			item.JenisBarang = category.Nama
+		} else {
+			item.KategoriID = nil
+			item.JenisBarang = strings.TrimSpace(req.JenisBarang)
+		}
 	}
-	if req.Satuan != "" {
-		item.Satuan = req.Satuan
+	if strings.TrimSpace(req.Satuan) != "" {
+		satuan, ok := resolveBaseUnit(c, db, req.Satuan)
+		if !ok {
+			return
+		}
+		if !strings.EqualFold(satuan, strings.TrimSpace(item.Satuan)) && !ensureBaseUnitChangeable(c, db, &item) {
+			return
+		}
+		item.Satuan = satuan
 	}
 	if req.StokMinimal != nil {
 		item.StokMinimal = *req.StokMinimal
@@ -173,6 +417,10 @@ func UpdateProduct(c *gin.Context) {
 	}
 
 	if err := db.Save(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			respondKodeBarangConflict(c, db, item.KodeBarang, item.ID)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
@@ -183,7 +431,8 @@ func UpdateProduct(c *gin.Context) {
 	})
 }
 
-// DeleteProduct removes a product by ID
+// DeleteProduct soft-deletes a product. A product that still holds stock or has opnames awaiting approval
+// is refused with a 409 listing those dependencies; its transaction history is kept either way.
 func DeleteProduct(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -196,15 +445,272 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	result := db.Delete(&models.Produk{}, id)
-	if result.Error != nil {
+	var item models.Produk
+	if err := db.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
 		return
 	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+
+	deps, err := findProductDependencies(db, item.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check product dependencies"})
+		return
+	}
+	if deps.TotalStock != 0 || len(deps.Stock) > 0 || deps.PendingOpnames > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":        "Product still has stock or pending opnames and cannot be deleted",
+			"dependencies": deps,
+		})
+		return
+	}
+
+	if err := db.Delete(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Product deleted successfully",
+		"transactions": deps.Transactions,
+	})
+}
+
+// productDependencies lists the records that refer to a product
+type productDependencies struct {
+	Stock          []stockDependency `json:"stock"` // warehouses holding non-zero stock
+	TotalStock     int64             `json:"total_stock"`
+	PendingOpnames int64             `json:"pending_opnames"`
+	Transactions   int64             `json:"transactions"` // kept after deletion
+}
+
+type stockDependency struct {
+	GudangID uint   `json:"gudang_id"`
+	Gudang   string `json:"gudang"`
+	Jumlah   int    `json:"jumlah"`
+}
+
+func findProductDependencies(db *gorm.DB, produkID uint) (*productDependencies, error) {
+	deps := &productDependencies{Stock: []stockDependency{}}
+
+	if err := db.Table("stok_gudang").
+		Select("stok_gudang.gudang_id, gudang.nama AS gudang, stok_gudang.jumlah").
+		Joins("LEFT JOIN gudang ON gudang.id = stok_gudang.gudang_id").
+		Where("stok_gudang.produk_id = ? AND stok_gudang.jumlah <> 0", produkID).
+		Order("stok_gudang.gudang_id").
+		Scan(&deps.Stock).Error; err != nil {
+		return nil, err
+	}
+	for _, stock := range deps.Stock {
+		deps.TotalStock += int64(stock.Jumlah)
+	}
+
+	if err := db.Model(&models.StockOpname{}).Where("produk_id = ? AND sudah_disetujui = ?", produkID, false).
+		Count(&deps.PendingOpnames).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.Transaction{}).Where("produk_id = ?", produkID).Count(&deps.Transactions).Error; err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+// RestoreProduct brings back a deleted product, provided its code has not been reused in the meantime
+func RestoreProduct(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var item models.Produk
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deleted product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore product"})
+		return
+	}
+
+	if !ensureUniqueKodeBarang(c, db, item.KodeBarang, item.ID) {
+		return
+	}
+
+	updates := map[string]interface{}{"deleted_at": nil}
+	// The category may have been removed while the product was deleted
+	if item.KategoriID != nil {
+		var count int64
+		if err := db.Model(&models.Category{}).Where("id = ?", *item.KategoriID).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore product"})
+			return
+		}
+		if count == 0 {
+			updates["kategori_id"] = nil
+			item.KategoriID = nil
+		}
+	}
+
+	if err := db.Unscoped().Model(&item).Updates(updates).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			respondKodeBarangConflict(c, db, item.KodeBarang, item.ID)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore product"})
 		return
 	}
+	item.DeletedAt = gorm.DeletedAt{}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Product restored successfully",
+		"data":    item,
+	})
+}
+
+// withDeleted applies the show_deleted query parameter: "true" includes deleted products, "only" returns just those
+func withDeleted(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	switch c.Query("show_deleted") {
+	case "", "false":
+		return query, true
+	case "true":
+		return query.Unscoped(), true
+	case "only":
+		return query.Unscoped().Where("deleted_at IS NOT NULL"), true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid show_deleted, must be true, false or only"})
+		return nil, false
+	}
+}
+
+// ensureUniqueKodeBarang checks that no other product uses the code, ignoring case.
+// It writes a 409 response identifying the conflicting product if one does.
+func ensureUniqueKodeBarang(c *gin.Context, db *gorm.DB, kodeBarang string, excludeID uint) bool {
+	var existing models.Produk
+	err := db.Where("LOWER(kode_barang) = LOWER(?) AND id <> ?", kodeBarang, excludeID).Order("id ASC").First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check product code"})
+		return false
+	}
+
+	c.JSON(http.StatusConflict, gin.H{
+		"error": fmt.Sprintf("Product code %q is already used by another product", existing.KodeBarang),
+		"conflict": gin.H{
+			"id":          existing.ID,
+			"kode_barang": existing.KodeBarang,
+			"nama_barang": existing.NamaBarang,
+		},
+	})
+	return false
+}
+
+// respondKodeBarangConflict answers a unique index violation on kode_barang with a 409, naming the
+// conflicting product when it can still be found
+func respondKodeBarangConflict(c *gin.Context, db *gorm.DB, kodeBarang string, excludeID uint) {
+	if ensureUniqueKodeBarang(c, db, kodeBarang, excludeID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Product code is already used by another product"})
+	}
+}
+
+// GetDuplicateProducts lists groups of products sharing the same code (ignoring case) so they can be cleaned up
+func GetDuplicateProducts(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var keys []string
+	if err := db.Model(&models.Produk{}).
+		Select("LOWER(kode_barang)").
+		Group("LOWER(kode_barang)").
+		Having("COUNT(*) > 1").
+		Order("LOWER(kode_barang)").
+		Pluck("LOWER(kode_barang)", &keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch duplicate products"})
+		return
+	}
+
+	var items []models.Produk
+	if len(keys) > 0 {
+		if err := db.Where("LOWER(kode_barang) IN ?", keys).Order("LOWER(kode_barang), id").Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch duplicate products"})
+			return
+		}
+	}
+
+	groups := make([]gin.H, 0, len(keys))
+	index := map[string]int{}
+	for _, item := range items {
+		key := strings.ToLower(item.KodeBarang)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, gin.H{"kode_barang": key, "products": []models.Produk{}})
+		}
+		groups[i]["products"] = append(groups[i]["products"].([]models.Produk), item)
+	}
+	for _, group := range groups {
+		group["count"] = len(group["products"].([]models.Produk))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  groups,
+		"total": len(groups),
+	})
+}
+
+// resolveProductCategory finds the category for a product: kategori_id wins, otherwise a top-level
+// category whose name matches jenis_barang (ignoring case) is used. A nil category means free text only.
+func resolveProductCategory(c *gin.Context, db *gorm.DB, kategoriID *uint, jenisBarang string) (*models.Category, bool) {
+	category, err := findProductCategory(db, kategoriID, jenisBarang)
+	if errors.Is(err, errCategoryNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve category"})
+		return nil, false
+	}
+	return category, true
+}
+
+var errCategoryNotFound = errors.New("category not found")
+
+// findProductCategory is the lookup behind resolveProductCategory; an unknown kategori_id gives errCategoryNotFound
+func findProductCategory(db *gorm.DB, kategoriID *uint, jenisBarang string) (*models.Category, error) {
+	var category models.Category
+	if kategoriID != nil {
+		if err := db.First(&category, *kategoriID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errCategoryNotFound
+			}
+			return nil, err
+		}
+		return &category, nil
+	}
+
+	jenisBarang = strings.TrimSpace(jenisBarang)
+	if jenisBarang == "" {
+		return nil, nil
+	}
+
+	err := db.Where("LOWER(nama) = LOWER(?) AND parent_id IS NULL", jenisBarang).First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
 }
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"inventory-backend/config"
+	"inventory-backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// GetMe returns the profile of the authenticated user
+func GetMe(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	gudangIDs, allGudangs, err := gudangScope(c, db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var gudangs []models.Gudang
+	if err := restrictToGudangs(db, "id", gudangIDs, allGudangs).Order("id ASC").Find(&gudangs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    user,
+		"gudangs": gudangs,
+	})
+}
+
+// UpdateMeRequest holds the profile fields a user may change themselves
+type UpdateMeRequest struct {
+	Name string `json:"name" binding:"required,min=3,max=100"`
+}
+
+// UpdateMe updates the profile of the authenticated user
+func UpdateMe(c *gin.Context) {
+	var req UpdateMeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	if err := db.Model(user).Update("name", req.Name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Profile updated successfully",
+		"data":    user,
+	})
+}
+
+// ChangePasswordRequest holds data for changing the authenticated user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword sets a new password after verifying the current one and ends all other sessions
+func ChangePassword(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		logSecurityEvent(c, db, EventPasswordChanged, user.ID, user.Email, map[string]interface{}{"success": false})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := checkNewPassword(db, cfg, user, req.NewPassword); err != nil {
+		if !respondPasswordRejected(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate password"})
+		}
+		return
+	}
+
+	// Hash new password
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+		if err := recordPasswordHistory(tx, cfg, user.ID, hashedPassword); err != nil {
+			return err
+		}
+		return revokeOtherSessions(tx, user.ID, c.GetString("session_id"))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	logSecurityEvent(c, db, EventPasswordChanged, user.ID, user.Email, map[string]interface{}{"success": true})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully, other sessions have been logged out"})
+}
@@ -0,0 +1,393 @@
+package controllers
+
+import (
+	"errors"
+	"inventory-backend/config"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// issueTokens creates a refresh token and signs a matching access token for the requesting client.
+// A nil previous token starts a new session; otherwise the token continues previous's session.
+func issueTokens(c *gin.Context, db *gorm.DB, cfg *config.Config, user *models.User, previous *models.RefreshToken) (gin.H, error) {
+	now := time.Now()
+	record := models.RefreshToken{
+		UserID:           user.ID,
+		ExpiresAt:        now.Add(cfg.RefreshExpiry),
+		SessionStartedAt: now,
+		LastSeenAt:       &now,
+		IPAddress:        c.ClientIP(),
+		UserAgent:        truncate(c.Request.UserAgent(), 255),
+	}
+
+	if previous != nil {
+		record.FamilyID = previous.FamilyID
+		record.SessionStartedAt = previous.SessionStartedAt
+	} else {
+		id, err := utils.GenerateRandomToken(16)
+		if err != nil {
+			return nil, err
+		}
+		record.FamilyID = id
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	record.TokenHash = utils.HashToken(refreshToken)
+
+	if err := db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, expiresAt, err := utils.GenerateToken(cfg.JWTSecret, user.ID, user.Role, record.FamilyID, cfg.JWTExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":              accessToken,
+		"expires_at":         expiresAt,
+		"refresh_token":      refreshToken,
+		"refresh_expires_at": record.ExpiresAt,
+	}, nil
+}
+
+// revokeSession revokes every refresh token in a family, ending that login session
+func revokeSession(db *gorm.DB, familyID string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeAllSessions revokes every refresh token belonging to a user
+func revokeAllSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeOtherSessions revokes every session of a user except the one identified by keepFamilyID
+func revokeOtherSessions(db *gorm.DB, userID uint, keepFamilyID string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, keepFamilyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RefreshRequest holds the refresh token to exchange
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh rotates a refresh token and issues a new access token
+func Refresh(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var record models.RefreshToken
+	if err := cfg.DB.Where("token_hash = ?", utils.HashToken(req.RefreshToken)).First(&record).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	if record.RevokedAt != nil || time.Now().After(record.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	// A token that was already rotated is being replayed: assume it leaked and end the session
+	if record.UsedAt != nil {
+		revokeSession(cfg.DB, record.FamilyID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used, session revoked"})
+		return
+	}
+
+	var user models.User
+	if err := cfg.DB.Where("deactivated_at IS NULL").First(&user, record.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	var tokens gin.H
+	err := cfg.DB.Transaction(func(tx *gorm.DB) error {
+		// Mark as used only if no concurrent request rotated it first
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", record.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		issued, err := issueTokens(c, tx, cfg, &user, &record)
+		if err != nil {
+			return err
+		}
+		tokens = issued
+		return nil
+	})
+
+	if errors.Is(err, errRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+var errRefreshTokenReused = errors.New("refresh token already used")
+
+// Logout revokes the session the current access token belongs to
+func Logout(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	if err := revokeSession(db, c.GetString("session_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	if user, ok := c.Get("user"); ok {
+		if u, ok := user.(*models.User); ok {
+			logSecurityEvent(c, db, EventLogout, u.ID, u.Email, nil)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+}
+
+// LogoutAll revokes every session of the current user, logging out all devices
+func LogoutAll(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	if err := revokeAllSessions(db, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	logSecurityEvent(c, db, EventLogoutAll, user.ID, user.Email, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
+}
+
+// activeSessions returns the current refresh token of every live session of a user, most recently used first
+func activeSessions(db *gorm.DB, userID uint) ([]models.RefreshToken, error) {
+	var sessions []models.RefreshToken
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND used_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("COALESCE(last_seen_at, created_at) DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// sessionResponse describes a session without exposing token details
+func sessionResponse(session models.RefreshToken, currentSessionID string) gin.H {
+	lastSeen := session.CreatedAt
+	if session.LastSeenAt != nil && session.LastSeenAt.After(lastSeen) {
+		lastSeen = *session.LastSeenAt
+	}
+
+	return gin.H{
+		"id":           session.FamilyID,
+		"device":       describeDevice(session.UserAgent),
+		"user_agent":   session.UserAgent,
+		"ip_address":   session.IPAddress,
+		"created_at":   session.SessionStartedAt,
+		"last_seen_at": lastSeen,
+		"expires_at":   session.ExpiresAt,
+		"current":      session.FamilyID == currentSessionID,
+	}
+}
+
+// respondSessions writes the active sessions of a user
+func respondSessions(c *gin.Context, db *gorm.DB, userID uint) {
+	sessions, err := activeSessions(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	data := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		data = append(data, sessionResponse(session, c.GetString("session_id")))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  data,
+		"total": len(data),
+	})
+}
+
+// revokeUserSession ends one session of a user, writing a 404 response if it does not exist
+func revokeUserSession(c *gin.Context, db *gorm.DB, user *models.User, sessionID string) bool {
+	result := db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL", user.ID, sessionID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return false
+	}
+
+	logSecurityEvent(c, db, EventSessionRevoked, user.ID, user.Email, map[string]interface{}{"session_id": sessionID})
+	return true
+}
+
+// GetMySessions lists the active sessions of the current user
+func GetMySessions(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	respondSessions(c, db, user.ID)
+}
+
+// RevokeMySession ends one of the current user's sessions, e.g. a lost device
+func RevokeMySession(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	if !revokeUserSession(c, db, user, c.Param("sessionId")) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// GetUserSessions lists the active sessions of any user
+func GetUserSessions(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	user, ok := findUser(c, db)
+	if !ok {
+		return
+	}
+
+	respondSessions(c, db, user.ID)
+}
+
+// RevokeUserSession ends one session of any user
+func RevokeUserSession(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	user, ok := findUser(c, db)
+	if !ok {
+		return
+	}
+
+	if !revokeUserSession(c, db, user, c.Param("sessionId")) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// ForceLogoutUser ends every session of a user; their access tokens stop working immediately
+func ForceLogoutUser(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	user, ok := findUser(c, db)
+	if !ok {
+		return
+	}
+
+	if err := revokeAllSessions(db, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout user"})
+		return
+	}
+
+	logSecurityEvent(c, db, EventForceLogout, user.ID, user.Email, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out from all devices"})
+}
+
+// describeDevice turns a user agent into a short "Browser on OS" label
+func describeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+		{"okhttp/", "Android app"},
+		{"Dart/", "Mobile app"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	for _, o := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			return browser + " on " + o.name
+		}
+	}
+	return browser
+}
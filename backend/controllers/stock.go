@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"errors"
 	"inventory-backend/models"
-	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,11 +15,12 @@ import (
 
 // CreateTransactionRequest holds data for creating a transaction
 type CreateTransactionRequest struct {
-	ProdukID uint   `json:"produk_id" binding:"required"`
+	ProdukID uint   `json:"produk_id"`
+	Barcode  string `json:"barcode"` // alternative to produk_id for scanned products
 	GudangID uint   `json:"gudang_id" binding:"required"`
-	UserID   uint   `json:"user_id" binding:"required"`
 	Tipe     string `json:"tipe" binding:"required,oneof=masuk keluar"` // masuk or keluar
-	Jumlah   int    `json:"jumlah" binding:"required,gt=0"`
+	Jumlah   int    `json:"jumlah" binding:"required,gt=0,max=2147483647"`
+	Satuan   string `json:"satuan"` // optional, defaults to the product's base unit
 }
 
 // CreateTransaction creates a new transaction and updates stock in stok_gudang
@@ -28,11 +31,47 @@ func CreateTransaction(c *gin.Context) {
 		return
 	}
 
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	db, ok := getDB(c)
 	if !ok {
 		return
 	}
 
+	// Users may only move stock in warehouses they are assigned to
+	if !requireGudangAccess(c, db, req.GudangID) {
+		return
+	}
+
+	if req.ProdukID == 0 && strings.TrimSpace(req.Barcode) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "produk_id or barcode is required"})
+		return
+	}
+
+	// A scanned barcode identifies the product and, for packaging barcodes, the unit counted
+	if strings.TrimSpace(req.Barcode) != "" {
+		barcode, err := findBarcode(db, req.Barcode)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No product has this barcode"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if req.ProdukID != 0 && req.ProdukID != barcode.ProdukID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Barcode belongs to a different product"})
+			return
+		}
+		req.ProdukID = barcode.ProdukID
+		if strings.TrimSpace(req.Satuan) == "" && barcode.Satuan != nil {
+			req.Satuan = barcode.Satuan.Kode
+		}
+	}
+
 	// Validate that product exists
 	var produk models.Produk
 	if err := db.First(&produk, req.ProdukID).Error; err != nil {
@@ -44,6 +83,27 @@ func CreateTransaction(c *gin.Context) {
 		return
 	}
 
+	// Convert the entered quantity to the product's base unit
+	factor, err := productUnitFactor(db, &produk, req.Satuan)
+	if errors.Is(err, errUnknownUnit) {
+		respondUnknownUnit(c, &produk, req.Satuan)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Quantities are stored as 32-bit integers; keep the converted amount within range
+	if req.Jumlah > math.MaxInt32/factor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "jumlah is too large"})
+		return
+	}
+	jumlah := req.Jumlah * factor
+	satuan := produk.Satuan
+	if strings.TrimSpace(req.Satuan) != "" {
+		satuan = strings.TrimSpace(req.Satuan)
+	}
+
 	// Get or create stock record in stok_gudang
 	var stock models.StockGudang
 	result := db.Where("produk_id = ? AND gudang_id = ?", req.ProdukID, req.GudangID).First(&stock)
@@ -64,34 +124,63 @@ func CreateTransaction(c *gin.Context) {
 		return
 	}
 
-	// Calculate new stock quantity
-	var newQuantity int
-	if req.Tipe == "masuk" {
-		newQuantity = stock.Jumlah + req.Jumlah
-	} else { // keluar
-		newQuantity = stock.Jumlah - req.Jumlah
-		// Validate that outgoing doesn't exceed current stock
-		if newQuantity < 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Insufficient stock",
-				"current_stock": stock.Jumlah,
-				"requested": req.Jumlah,
-			})
-			return
-		}
+	// Apply the change in one conditional UPDATE so concurrent transactions cannot overwrite each other;
+	// the bound keeps outgoing stock from going negative and incoming stock within a 32-bit integer
+	delta, bound := jumlah, "jumlah <= ?"
+	limit := math.MaxInt32 - jumlah
+	if req.Tipe == "keluar" {
+		delta, bound, limit = -jumlah, "jumlah >= ?", jumlah
 	}
 
 	// Start transaction for atomic operations
 	tx := db.Begin()
 
+	// Update stock quantity
+	update := tx.Model(&models.StockGudang{}).
+		Where("id = ?", stock.ID).
+		Where(bound, limit).
+		Update("jumlah", gorm.Expr("jumlah + ?", delta))
+	if update.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+		return
+	}
+	if update.RowsAffected != 1 {
+		tx.Rollback()
+		if err := db.First(&stock, stock.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+			return
+		}
+		if req.Tipe == "masuk" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Stock would exceed the maximum quantity"})
+			return
+		}
+		// Validate that outgoing doesn't exceed current stock
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Insufficient stock",
+			"current_stock": stock.Jumlah,
+			"requested":     jumlah,
+			"satuan":        produk.Satuan,
+		})
+		return
+	}
+	if err := tx.First(&stock, stock.ID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+		return
+	}
+
 	// Create transaction record
 	transaction := models.Transaction{
 		ProdukID: req.ProdukID,
 		GudangID: req.GudangID,
-		UserID:   req.UserID,
+		UserID:   user.ID,
 		Tipe:     req.Tipe,
-		Jumlah:   req.Jumlah,
+		Jumlah:   jumlah,
 		Tanggal:  time.Now(),
+
+		JumlahInput: req.Jumlah,
+		SatuanInput: satuan,
 	}
 	if err := tx.Create(&transaction).Error; err != nil {
 		tx.Rollback()
@@ -99,13 +188,6 @@ func CreateTransaction(c *gin.Context) {
 		return
 	}
 
-	// Update stock quantity
-	if err := tx.Model(&stock).Update("jumlah", newQuantity).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
-		return
-	}
-
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
@@ -116,11 +198,14 @@ func CreateTransaction(c *gin.Context) {
 		"message": "Transaction created successfully",
 		"data": gin.H{
 			"transaction_id": transaction.ID,
-			"product_id": transaction.ProdukID,
-			"type": transaction.Tipe,
-			"quantity": transaction.Jumlah,
-			"new_stock": newQuantity,
-			"created_at": transaction.CreatedAt,
+			"product_id":     transaction.ProdukID,
+			"type":           transaction.Tipe,
+			"quantity":       transaction.Jumlah,
+			"satuan":         produk.Satuan,
+			"quantity_input": transaction.JumlahInput,
+			"satuan_input":   transaction.SatuanInput,
+			"new_stock":      stock.Jumlah,
+			"created_at":     transaction.CreatedAt,
 		},
 	})
 }
@@ -128,16 +213,28 @@ func CreateTransaction(c *gin.Context) {
 // GetTransactions returns all transactions with optional filtering
 func GetTransactions(c *gin.Context) {
 	produkIDStr := c.Query("produk_id")
+	gudangIDStr := c.Query("gudang_id")
 	tipe := c.Query("tipe") // filter by "in" or "out"
 
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	db, ok := getDB(c)
 	if !ok {
 		return
 	}
 
+	gudangIDs, allGudangs, err := gudangScope(c, db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var transactions []models.Transaction
 
-	query := db
+	query := restrictToGudangs(db, "gudang_id", gudangIDs, allGudangs)
 
 	if produkIDStr != "" {
 		produkID, err := strconv.Atoi(produkIDStr)
@@ -148,6 +245,15 @@ func GetTransactions(c *gin.Context) {
 		query = query.Where("produk_id = ?", produkID)
 	}
 
+	if gudangIDStr != "" {
+		gudangID, err := strconv.Atoi(gudangIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gudang_id"})
+			return
+		}
+		query = query.Where("gudang_id = ?", gudangID)
+	}
+
 	if tipe != "" {
 		query = query.Where("tipe = ?", tipe)
 	}
@@ -187,6 +293,10 @@ func GetTransaction(c *gin.Context) {
 		return
 	}
 
+	if !requireGudangAccess(c, db, transaction.GudangID) {
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": transaction})
 }
 
@@ -195,14 +305,25 @@ func GetStockCards(c *gin.Context) {
 	// Optional filter by product_id
 	productIDStr := c.Query("product_id")
 	
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	db, ok := getDB(c)
 	if !ok {
 		return
 	}
 
+	gudangIDs, allGudangs, err := gudangScope(c, db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var stocks []models.StockGudang
 
-	query := db
+	query := restrictToGudangs(db, "gudang_id", gudangIDs, allGudangs)
 
 	if productIDStr != "" {
 		productID, err := strconv.Atoi(productIDStr)
@@ -213,17 +334,82 @@ func GetStockCards(c *gin.Context) {
 		query = query.Where("produk_id = ?", productID)
 	}
 
+	categoryIDs, byCategory, ok := categoryFilterIDs(c, db)
+	if !ok {
+		return
+	}
+	if byCategory {
+		query = query.Where("produk_id IN (?)", db.Model(&models.Produk{}).Select("id").Where("kategori_id IN ?", categoryIDs))
+	}
+
 	if err := query.Find(&stocks).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if satuan := strings.TrimSpace(c.Query("satuan")); satuan != "" {
+		rows, ok := convertStockRows(c, db, stocks, satuan, productIDStr != "")
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"data":  rows,
+			"total": len(rows),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"data":  stocks,
 		"total": len(stocks),
 	})
 }
 
+// stockUnitRow is a stock record with its quantity expressed in a requested unit
+type stockUnitRow struct {
+	models.StockGudang
+	Satuan       string   `json:"satuan"`
+	JumlahSatuan *float64 `json:"jumlah_satuan"`
+}
+
+// convertStockRows expresses stock records in the given unit. Products without that unit get a null
+// jumlah_satuan, unless strict is set (a single product was requested) in which case a 400 is written.
+func convertStockRows(c *gin.Context, db *gorm.DB, stocks []models.StockGudang, satuan string, strict bool) ([]stockUnitRow, bool) {
+	factors := map[uint]int{}
+	rows := make([]stockUnitRow, 0, len(stocks))
+	for _, stock := range stocks {
+		factor, seen := factors[stock.ProdukID]
+		if !seen {
+			var produk models.Produk
+			if err := db.Unscoped().First(&produk, stock.ProdukID).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return nil, false
+			}
+			var err error
+			factor, err = productUnitFactor(db, &produk, satuan)
+			if errors.Is(err, errUnknownUnit) {
+				if strict {
+					respondUnknownUnit(c, &produk, satuan)
+					return nil, false
+				}
+				factor = 0
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return nil, false
+			}
+			factors[stock.ProdukID] = factor
+		}
+
+		row := stockUnitRow{StockGudang: stock, Satuan: satuan}
+		if factor > 0 {
+			converted := stockInUnit(int64(stock.Jumlah), factor)
+			row.JumlahSatuan = &converted
+		}
+		rows = append(rows, row)
+	}
+	return rows, true
+}
+
 // GetStockCard returns a single stock record by ID
 func GetStockCard(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -248,6 +434,10 @@ func GetStockCard(c *gin.Context) {
 		return
 	}
 
+	if !requireGudangAccess(c, db, stock.GudangID) {
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": stock})
 }
 
@@ -256,7 +446,6 @@ type CreateStockOpnameRequest struct {
 	ProdukID   uint   `json:"produk_id" binding:"required"`
 	StokSistem int    `json:"stok_sistem" binding:"required,gte=0"`
 	StokFisik  int    `json:"stok_fisik" binding:"required,gte=0"`
-	UserID     uint   `json:"user_id" binding:"required"`
 	Keterangan string `json:"keterangan"`
 }
 
@@ -268,6 +457,11 @@ func CreateStockOpname(c *gin.Context) {
 		return
 	}
 
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	db, ok := getDB(c)
 	if !ok {
 		return
@@ -284,9 +478,6 @@ func CreateStockOpname(c *gin.Context) {
 		return
 	}
 
-	// Log user lookup for debugging
-	log.Printf("🔍 Checking user_id: %d", req.UserID)
-
 	// Calculate difference
 	selisih := req.StokFisik - req.StokSistem
 
@@ -296,7 +487,7 @@ func CreateStockOpname(c *gin.Context) {
 		StokSistem:     req.StokSistem,
 		StokFisik:      req.StokFisik,
 		Selisih:        selisih,
-		UserID:         req.UserID,
+		UserID:         user.ID,
 		Keterangan:     req.Keterangan,
 		SudahDisetujui: false,
 		Tanggal:        time.Now(),
@@ -355,16 +546,62 @@ func GetStockOpnameByID(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": opname})
 }
 
-// GetGudangs returns all warehouses
+// ApproveStockOpname marks a stock opname record as approved
+func ApproveStockOpname(c *gin.Context) {
+	id := c.Param("id")
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var opname models.StockOpname
+	if err := db.First(&opname, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Stock opname record not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if opname.SudahDisetujui {
+		c.JSON(http.StatusConflict, gin.H{"error": "Stock opname record is already approved"})
+		return
+	}
+
+	if err := db.Model(&opname).Update("sudah_disetujui", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    opname,
+		"message": "Stock opname record approved successfully",
+	})
+}
+
+// GetGudangs returns the warehouses the current user is assigned to (all for admins)
 func GetGudangs(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	db, ok := getDB(c)
 	if !ok {
 		return
 	}
 
+	gudangIDs, allGudangs, err := gudangScope(c, db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var gudangs []models.Gudang
 
-	if err := db.Find(&gudangs).Error; err != nil {
+	if err := restrictToGudangs(db, "id", gudangIDs, allGudangs).Find(&gudangs).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -378,26 +615,34 @@ func GetGudangs(c *gin.Context) {
 // GetProductTotalStock returns total stock of a product across all warehouses
 func GetProductTotalStock(c *gin.Context) {
 	produkIDStr := c.Param("produk_id")
-	log.Printf("🔍 GET /products/stock/:produk_id called with produk_id: %s", produkIDStr)
 
 	// Convert string to uint
 	produkID, err := strconv.ParseUint(produkIDStr, 10, 32)
 	if err != nil {
-		log.Printf("❌ Invalid produk_id format: %s", produkIDStr)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid produk_id format"})
 		return
 	}
 
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	db, ok := getDB(c)
 	if !ok {
 		return
 	}
 
+	gudangIDs, allGudangs, err := gudangScope(c, db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Validate that product exists
 	var produk models.Produk
 	if err := db.First(&produk, produkID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			log.Printf("❌ Product not found: %d", produkID)
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -405,36 +650,40 @@ func GetProductTotalStock(c *gin.Context) {
 		return
 	}
 
-	log.Printf("✅ Product found: %s (%s)", produk.NamaBarang, produk.KodeBarang)
-
-	// Debug: Check stok_gudang table contents
-	var debugStocks []models.StockGudang
-	db.Where("produk_id = ?", uint(produkID)).Find(&debugStocks)
-	log.Printf("🔎 Found %d stock records for produk_id %d:", len(debugStocks), uint(produkID))
-	for _, stock := range debugStocks {
-		log.Printf("   - ID: %d, ProdukID: %d, GudangID: %d, Jumlah: %d", stock.ID, stock.ProdukID, stock.GudangID, stock.Jumlah)
-	}
-
-	// Calculate total stock across all warehouses using simpler query
+	// Calculate total stock across the warehouses the user can access
 	var totalStock int64 = 0
-	result := db.Model(&models.StockGudang{}).
+	result := restrictToGudangs(db.Model(&models.StockGudang{}), "gudang_id", gudangIDs, allGudangs).
 		Where("produk_id = ?", uint(produkID)).
 		Select("COALESCE(SUM(jumlah), 0) as total").
 		Scan(&totalStock)
-	
 	if result.Error != nil {
-		log.Printf("❌ Error calculating stock: %v", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
 
-	log.Printf("📦 Total stock for produk_id %s: %d", produkID, totalStock)
+	data := gin.H{
+		"produk_id":   produk.ID,
+		"nama_barang": produk.NamaBarang,
+		"total_stock": totalStock,
+		"satuan":      produk.Satuan,
+	}
+
+	// Optionally express the total in another configured unit, e.g. ?satuan=box
+	if satuan := strings.TrimSpace(c.Query("satuan")); satuan != "" {
+		factor, err := productUnitFactor(db, &produk, satuan)
+		if errors.Is(err, errUnknownUnit) {
+			respondUnknownUnit(c, &produk, satuan)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data["total_stock_in_unit"] = stockInUnit(totalStock, factor)
+		data["unit"] = satuan
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"data": gin.H{
-			"produk_id":   produk.ID,
-			"nama_barang": produk.NamaBarang,
-			"total_stock": totalStock,
-		},
+		"data": data,
 	})
 }
@@ -0,0 +1,403 @@
+package controllers
+
+import (
+	"inventory-backend/config"
+	"inventory-backend/middleware"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// twoFactorChallengeExpiry is how long a user has to enter their code after the password step
+const twoFactorChallengeExpiry = 5 * time.Minute
+
+// recoveryCodeCount is the number of recovery codes generated on enrollment
+const recoveryCodeCount = 10
+
+// startTwoFactorChallenge responds to a successful first login step with a challenge token instead of a session
+func startTwoFactorChallenge(c *gin.Context, cfg *config.Config, user *models.User, method string) {
+	token, expiresAt, err := utils.GenerateChallengeToken(cfg.JWTSecret, user.ID, utils.ChallengePurposeTwoFactor, method, twoFactorChallengeExpiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Two-factor authentication required",
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"expires_at":          expiresAt,
+	})
+}
+
+// verifySecondFactor checks a TOTP code or, failing that, consumes a recovery code
+func verifySecondFactor(db *gorm.DB, user *models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		// Claim the time step in one statement so a code cannot be replayed, even by parallel requests
+		result := db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil || result.RowsAffected != 1 {
+			return false, result.Error
+		}
+		user.TOTPLastStep = step
+		return true, nil
+	}
+
+	if recoveryCode != "" {
+		result := db.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalizeRecoveryCode(recoveryCode))).
+			Update("used_at", time.Now())
+		return result.RowsAffected > 0, result.Error
+	}
+
+	return false, nil
+}
+
+// secondFactorThrottled responds with 429 while the account has to wait after failed attempts.
+// Wrong codes count towards the same lockout as wrong passwords; action names the 2FA operation, if not a login.
+func secondFactorThrottled(c *gin.Context, cfg *config.Config, user *models.User, action string) bool {
+	wait := loginRetryAfter(user)
+	if wait <= 0 {
+		return false
+	}
+
+	logSecurityEvent(c, cfg.DB, EventLoginFailed, user.ID, user.Email, secondFactorDetails("rate_limited", action))
+	c.Header("Retry-After", retryAfterSeconds(wait))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, please wait before retrying"})
+	return true
+}
+
+// rejectSecondFactor records a failed attempt towards the lockout and responds with 401
+func rejectSecondFactor(c *gin.Context, cfg *config.Config, user *models.User, reason, message, action string) {
+	if err := registerFailedLogin(c, cfg, user); err != nil {
+		log.Printf("Failed to record failed login for user %d: %v", user.ID, err)
+	}
+	logSecurityEvent(c, cfg.DB, EventLoginFailed, user.ID, user.Email, secondFactorDetails(reason, action))
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// confirmSecondFactor checks a TOTP or recovery code under the login lockout, responding itself on failure
+func confirmSecondFactor(c *gin.Context, cfg *config.Config, user *models.User, code, recoveryCode, action string) bool {
+	if secondFactorThrottled(c, cfg, user, action) {
+		return false
+	}
+
+	ok, err := verifySecondFactor(cfg.DB, user, code, recoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return false
+	}
+	if !ok {
+		rejectSecondFactor(c, cfg, user, "invalid_2fa_code", "Invalid authentication code", action)
+		return false
+	}
+	return true
+}
+
+func secondFactorDetails(reason, action string) map[string]interface{} {
+	details := map[string]interface{}{"reason": reason}
+	if action != "" {
+		details["action"] = action
+	}
+	return details
+}
+
+// generateRecoveryCodes replaces the user's recovery codes and returns the new plaintext codes
+func generateRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		for i := 0; i < recoveryCodeCount; i++ {
+			raw, err := utils.GenerateRandomToken(5)
+			if err != nil {
+				return err
+			}
+			code := raw[:5] + "-" + raw[5:]
+			if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(raw)}).Error; err != nil {
+				return err
+			}
+			codes = append(codes, code)
+		}
+		return nil
+	})
+	return codes, err
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// LoginTwoFactorRequest holds the second login step
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// LoginTwoFactor completes a login for users with 2FA enabled
+func LoginTwoFactor(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	var req LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	claims, err := utils.ParseChallengeToken(cfg.JWTSecret, req.ChallengeToken, utils.ChallengePurposeTwoFactor)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+		return
+	}
+
+	var user models.User
+	if err := cfg.DB.Where("deactivated_at IS NULL").First(&user, claims.UserID).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+		return
+	}
+
+	if !confirmSecondFactor(c, cfg, &user, req.Code, req.RecoveryCode, "") {
+		return
+	}
+
+	if err := registerSuccessfulLogin(cfg.DB, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record login"})
+		return
+	}
+
+	response, err := issueTokens(c, cfg.DB, cfg, &user, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	method := claims.Method
+	if method == "" {
+		method = "password"
+	}
+	if req.Code == "" {
+		method += "+recovery_code"
+	} else {
+		method += "+totp"
+	}
+	logSecurityEvent(c, cfg.DB, EventLoginSuccess, user.ID, user.Email, map[string]interface{}{"method": method})
+
+	response["message"] = "Login successful"
+	response["user"] = gin.H{
+		"id":    user.ID,
+		"name":  user.Name,
+		"email": user.Email,
+		"role":  user.Role,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SetupTwoFactor generates a new TOTP secret for the current user; it is activated by EnableTwoFactor
+func SetupTwoFactor(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if err := cfg.DB.Model(user).Update("totp_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"secret":           secret,
+			"provisioning_uri": utils.TOTPProvisioningURI(cfg.TOTPIssuer, user.Email, secret),
+		},
+	})
+}
+
+// TwoFactorCodeRequest holds a TOTP code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// EnableTwoFactor confirms enrollment with a code from the authenticator app and returns recovery codes
+func EnableTwoFactor(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Call the setup endpoint first"})
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(user.TOTPSecret, req.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	if err := cfg.DB.Model(user).Updates(map[string]interface{}{
+		"totp_enabled":   true,
+		"totp_last_step": step,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	logSecurityEvent(c, cfg.DB, EventTwoFactorEnabled, user.ID, user.Email, nil)
+
+	codes, err := generateRecoveryCodes(cfg.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication enabled",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableTwoFactorRequest holds the credentials required to turn off 2FA
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactor turns off 2FA for the current user after re-checking password and code
+func DisableTwoFactor(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if cfg.RequireAdmin2FA && user.Role == middleware.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for admin accounts"})
+		return
+	}
+
+	if secondFactorThrottled(c, cfg, user, "disable_2fa") {
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		rejectSecondFactor(c, cfg, user, "invalid_password", "Invalid password", "disable_2fa")
+		return
+	}
+	if !confirmSecondFactor(c, cfg, user, req.Code, "", "disable_2fa") {
+		return
+	}
+
+	err := cfg.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	logSecurityEvent(c, cfg.DB, EventTwoFactorDisabled, user.ID, user.Email, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func RegenerateRecoveryCodes(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !confirmSecondFactor(c, cfg, user, req.Code, "", "regenerate_recovery_codes") {
+		return
+	}
+
+	codes, err := generateRecoveryCodes(cfg.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	logSecurityEvent(c, cfg.DB, EventRecoveryCodesReset, user.ID, user.Email, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
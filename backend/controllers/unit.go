@@ -0,0 +1,422 @@
+package controllers
+
+import (
+	"errors"
+	"inventory-backend/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errUnknownUnit = errors.New("unit is not configured for this product")
+
+// productUnitFactor returns how many base units of the product one unit of kode holds.
+// The product's own base unit always has factor 1.
+func productUnitFactor(db *gorm.DB, produk *models.Produk, kode string) (int, error) {
+	kode = strings.TrimSpace(kode)
+	if kode == "" || strings.EqualFold(kode, strings.TrimSpace(produk.Satuan)) {
+		return 1, nil
+	}
+
+	var conversion models.ProductUnit
+	err := db.Joins("JOIN satuan ON satuan.id = produk_satuan.satuan_id").
+		Where("produk_satuan.produk_id = ? AND LOWER(satuan.kode) = LOWER(?)", produk.ID, kode).
+		First(&conversion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errUnknownUnit
+	}
+	if err != nil {
+		return 0, err
+	}
+	return conversion.Faktor, nil
+}
+
+// stockInUnit converts a base-unit quantity; fractions show partially filled units, e.g. 30 pcs = 1.25 box
+func stockInUnit(baseQuantity int64, factor int) float64 {
+	return float64(baseQuantity) / float64(factor)
+}
+
+// resolveBaseUnit looks a product's satuan up in the unit master and returns its canonical kode,
+// writing a 400 response if the unit does not exist
+func resolveBaseUnit(c *gin.Context, db *gorm.DB, kode string) (string, bool) {
+	kode = strings.TrimSpace(kode)
+	var unit models.Unit
+	if err := db.Where("LOWER(kode) = LOWER(?)", kode).First(&unit).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unit " + strconv.Quote(kode) + " does not exist, create it under /units first"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve unit"})
+		}
+		return "", false
+	}
+	return unit.Kode, true
+}
+
+// ensureBaseUnitChangeable refuses to change the base unit of a product whose stock or unit conversions
+// are expressed in it, since those would silently be reinterpreted. It writes a 409 listing them.
+func ensureBaseUnitChangeable(c *gin.Context, db *gorm.DB, produk *models.Produk) bool {
+	deps, err := findProductDependencies(db, produk.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check product stock"})
+		return false
+	}
+	var conversions int64
+	if err := db.Model(&models.ProductUnit{}).Where("produk_id = ?", produk.ID).Count(&conversions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check unit conversions"})
+		return false
+	}
+	if len(deps.Stock) == 0 && conversions == 0 {
+		return true
+	}
+
+	c.JSON(http.StatusConflict, gin.H{
+		"error":       "Base unit cannot be changed while stock or unit conversions are recorded in it",
+		"base_satuan": produk.Satuan,
+		"stock":       deps.Stock,
+		"conversions": conversions,
+	})
+	return false
+}
+
+// respondUnknownUnit writes the 400 response for a unit a product cannot be counted in
+func respondUnknownUnit(c *gin.Context, produk *models.Produk, kode string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":       "Unit " + strconv.Quote(kode) + " is not configured for this product",
+		"base_satuan": produk.Satuan,
+	})
+}
+
+// findUnit loads a unit by the given route parameter, writing an error response if it fails
+func findUnit(c *gin.Context, db *gorm.DB, param string) (*models.Unit, bool) {
+	id, err := strconv.Atoi(c.Param(param))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unit ID"})
+		return nil, false
+	}
+
+	var unit models.Unit
+	if err := db.First(&unit, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unit not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch unit"})
+		}
+		return nil, false
+	}
+
+	return &unit, true
+}
+
+// findProduct loads a product by the :id route parameter, writing an error response if it fails
+func findProduct(c *gin.Context, db *gorm.DB) (*models.Produk, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return nil, false
+	}
+
+	var produk models.Produk
+	if err := db.First(&produk, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		}
+		return nil, false
+	}
+
+	return &produk, true
+}
+
+// GetUnits returns the unit of measure master
+func GetUnits(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	var units []models.Unit
+	if err := db.Order("kode ASC").Find(&units).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch units"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  units,
+		"total": len(units),
+	})
+}
+
+// UnitRequest holds data for creating or updating a unit
+type UnitRequest struct {
+	Kode string `json:"kode" binding:"required,max=20"`
+	Nama string `json:"nama" binding:"max=50"`
+}
+
+// CreateUnit adds a unit of measure
+func CreateUnit(c *gin.Context) {
+	var req UnitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	unit := models.Unit{Kode: strings.TrimSpace(req.Kode), Nama: strings.TrimSpace(req.Nama)}
+	if unit.Kode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kode is required"})
+		return
+	}
+	if unit.Nama == "" {
+		unit.Nama = unit.Kode
+	}
+
+	if err := db.Create(&unit).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Unit code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create unit"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Unit created successfully",
+		"data":    unit,
+	})
+}
+
+// UpdateUnit renames a unit; products using the old code as base unit are updated too
+func UpdateUnit(c *gin.Context) {
+	var req UnitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	unit, ok := findUnit(c, db, "id")
+	if !ok {
+		return
+	}
+
+	oldKode := unit.Kode
+	unit.Kode = strings.TrimSpace(req.Kode)
+	if unit.Kode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kode is required"})
+		return
+	}
+	if nama := strings.TrimSpace(req.Nama); nama != "" {
+		unit.Nama = nama
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(unit).Updates(map[string]interface{}{"kode": unit.Kode, "nama": unit.Nama}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Produk{}).Where("LOWER(satuan) = LOWER(?)", oldKode).Update("satuan", unit.Kode).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Unit code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update unit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Unit updated successfully",
+		"data":    unit,
+	})
+}
+
+// DeleteUnit removes a unit that no product uses as base unit or conversion
+func DeleteUnit(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	unit, ok := findUnit(c, db, "id")
+	if !ok {
+		return
+	}
+
+	var products, conversions, barcodes int64
+	if err := db.Model(&models.Produk{}).Where("LOWER(satuan) = LOWER(?)", unit.Kode).Count(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete unit"})
+		return
+	}
+	if err := db.Model(&models.ProductUnit{}).Where("satuan_id = ?", unit.ID).Count(&conversions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete unit"})
+		return
+	}
+	if err := db.Model(&models.ProductBarcode{}).Where("satuan_id = ?", unit.ID).Count(&barcodes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete unit"})
+		return
+	}
+	if products > 0 || conversions > 0 || barcodes > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "Unit is still used by products",
+			"products":    products,
+			"conversions": conversions,
+			"barcodes":    barcodes,
+		})
+		return
+	}
+
+	if err := db.Delete(unit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete unit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unit deleted successfully"})
+}
+
+// GetProductUnits lists the units a product can be counted in, starting with its base unit
+func GetProductUnits(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	produk, ok := findProduct(c, db)
+	if !ok {
+		return
+	}
+
+	var conversions []models.ProductUnit
+	if err := db.Preload("Satuan").Where("produk_id = ?", produk.ID).Order("faktor ASC").Find(&conversions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product units"})
+		return
+	}
+
+	units := []gin.H{{"satuan": produk.Satuan, "faktor": 1, "base": true}}
+	for _, conversion := range conversions {
+		if conversion.Satuan == nil {
+			continue
+		}
+		units = append(units, gin.H{
+			"satuan_id": conversion.SatuanID,
+			"satuan":    conversion.Satuan.Kode,
+			"faktor":    conversion.Faktor,
+			"base":      false,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  units,
+		"total": len(units),
+	})
+}
+
+// SetProductUnitRequest holds the conversion factor of an alternative unit
+type SetProductUnitRequest struct {
+	Faktor int `json:"faktor" binding:"required,gt=1"`
+}
+
+// SetProductUnit creates or updates the conversion of a unit to the product's base unit
+func SetProductUnit(c *gin.Context) {
+	var req SetProductUnitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	produk, ok := findProduct(c, db)
+	if !ok {
+		return
+	}
+
+	unit, ok := findUnit(c, db, "satuanId")
+	if !ok {
+		return
+	}
+
+	if strings.EqualFold(unit.Kode, strings.TrimSpace(produk.Satuan)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The base unit of a product always has factor 1"})
+		return
+	}
+
+	var conversion models.ProductUnit
+	err := db.Where("produk_id = ? AND satuan_id = ?", produk.ID, unit.ID).First(&conversion).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		conversion = models.ProductUnit{ProdukID: produk.ID, SatuanID: unit.ID, Faktor: req.Faktor}
+		err = db.Create(&conversion).Error
+	case err == nil:
+		conversion.Faktor = req.Faktor
+		err = db.Model(&conversion).Update("faktor", req.Faktor).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save product unit"})
+		return
+	}
+	conversion.Satuan = unit
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Product unit saved successfully",
+		"data":    conversion,
+	})
+}
+
+// DeleteProductUnit removes a unit conversion from a product
+func DeleteProductUnit(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	produk, ok := findProduct(c, db)
+	if !ok {
+		return
+	}
+
+	satuanID, err := strconv.Atoi(c.Param("satuanId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unit ID"})
+		return
+	}
+
+	var barcodes int64
+	if err := db.Model(&models.ProductBarcode{}).Where("produk_id = ? AND satuan_id = ?", produk.ID, satuanID).Count(&barcodes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product unit"})
+		return
+	}
+	if barcodes > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Product unit is still used by barcodes",
+			"barcodes": barcodes,
+		})
+		return
+	}
+
+	result := db.Where("produk_id = ? AND satuan_id = ?", produk.ID, satuanID).Delete(&models.ProductUnit{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product unit"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product unit not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product unit deleted successfully"})
+}
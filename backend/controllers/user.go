@@ -1,53 +1,150 @@
 package controllers
 
 import (
+	"fmt"
+	"inventory-backend/config"
+	"inventory-backend/middleware"
 	"inventory-backend/models"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// In-memory users store (replace with database)
-var users = []models.User{
-	{ID: 1, Name: "Administrator", Email: "admin@inventory.com", Role: "admin", CreatedAt: time.Now()},
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// parsePagination reads page and limit query parameters, writing a 400 response on invalid values
+func parsePagination(c *gin.Context) (page, limit int, ok bool) {
+	page, limit = 1, defaultPageLimit
+
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+			return 0, 0, false
+		}
+		page = n
+	}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid limit, must be between 1 and %d", maxPageLimit)})
+			return 0, 0, false
+		}
+		limit = n
+	}
+
+	return page, limit, true
+}
+
+// findUser loads a user by the :id route parameter, writing an error response if it fails
+func findUser(c *gin.Context, db *gorm.DB) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		}
+		return nil, false
+	}
+
+	return &user, true
 }
 
-// GetUsers returns all users
+// GetUsers returns users with pagination, search and filters
 func GetUsers(c *gin.Context) {
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	query := db.Model(&models.User{})
+
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		like := "%" + strings.ToLower(search) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(email) LIKE ?", like, like)
+	}
+
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	switch c.Query("status") {
+	case "", "all":
+	case "active":
+		query = query.Where("deactivated_at IS NULL")
+	case "inactive":
+		query = query.Where("deactivated_at IS NOT NULL")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status, must be one of: all, active, inactive"})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	var users []models.User
+	if err := query.Order("id ASC").Offset((page - 1) * limit).Limit(limit).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"data":  users,
-		"total": len(users),
+		"total": total,
+		"page":  page,
+		"limit": limit,
 	})
 }
 
 // GetUser returns a single user by ID
 func GetUser(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	db, ok := getDB(c)
+	if !ok {
 		return
 	}
 
-	for _, u := range users {
-		if u.ID == uint(id) {
-			c.JSON(http.StatusOK, gin.H{"data": u})
-			return
-		}
+	user, ok := findUser(c, db)
+	if !ok {
+		return
 	}
-	c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+
+	c.JSON(http.StatusOK, gin.H{"data": user})
 }
 
 // CreateUserRequest holds data for creating a user
 type CreateUserRequest struct {
-	Name  string `json:"name" binding:"required"`
+	Name  string `json:"name" binding:"required,min=3,max=100"`
 	Email string `json:"email" binding:"required,email"`
 	Role  string `json:"role" binding:"required,oneof=admin staff"`
 }
 
-// CreateUser creates a new user
+// CreateUser creates a new user without a password and emails them a link to set one
 func CreateUser(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
 	var req CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -55,42 +152,246 @@ func CreateUser(c *gin.Context) {
 	}
 
 	// Check duplicate email
-	for _, u := range users {
-		if u.Email == req.Email {
-			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
-			return
-		}
+	var existingUser models.User
+	if err := cfg.DB.Where("LOWER(email) = ?", strings.ToLower(req.Email)).First(&existingUser).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
 	}
 
+	// The empty password hash never matches, so the account is unusable until a password is set
 	newUser := models.User{
-		ID:        uint(len(users) + 1),
-		Name:      req.Name,
-		Email:     req.Email,
-		Role:      req.Role,
-		CreatedAt: time.Now(),
+		Name:  req.Name,
+		Email: req.Email,
+		Role:  req.Role,
+	}
+	if err := cfg.DB.Create(&newUser).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	logSecurityEvent(c, cfg.DB, EventUserCreated, newUser.ID, newUser.Email, map[string]interface{}{"role": newUser.Role})
+
+	if err := sendPasswordSetEmail(cfg, &newUser); err != nil {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "User created, but the password setup email could not be sent",
+			"data":    newUser,
+		})
+		return
 	}
-	users = append(users, newUser)
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User created successfully",
+		"message": "User created successfully, a password setup email has been sent",
 		"data":    newUser,
 	})
 }
 
-// DeleteUser removes a user by ID
-func DeleteUser(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+// UpdateUserRequest holds data for updating a user
+type UpdateUserRequest struct {
+	Name string `json:"name" binding:"omitempty,min=3,max=100"`
+	Role string `json:"role" binding:"omitempty,oneof=admin staff"`
+}
+
+// UpdateUser updates the name and/or role of a user
+func UpdateUser(c *gin.Context) {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
 		return
 	}
 
-	for i, u := range users {
-		if u.ID == uint(id) {
-			users = append(users[:i], users[i+1:]...)
-			c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+	user, ok := findUser(c, db)
+	if !ok {
+		return
+	}
+
+	if req.Role != "" && req.Role != user.Role && user.Role == middleware.RoleAdmin {
+		if !ensureAnotherActiveAdmin(c, db, user.ID) {
 			return
 		}
 	}
-	c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+
+	oldName, oldRole := user.Name, user.Role
+	if req.Name != "" {
+		user.Name = req.Name
+	}
+	if req.Role != "" {
+		user.Role = req.Role
+	}
+
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"name": user.Name,
+		"role": user.Role,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	if user.Name != oldName {
+		logSecurityEvent(c, db, EventUserUpdated, user.ID, user.Email, map[string]interface{}{"old_name": oldName, "new_name": user.Name})
+	}
+	if user.Role != oldRole {
+		logSecurityEvent(c, db, EventRoleChanged, user.ID, user.Email, map[string]interface{}{"old_role": oldRole, "new_role": user.Role})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User updated successfully",
+		"data":    user,
+	})
+}
+
+// DeactivateUser disables a user account and ends all of its sessions
+func DeactivateUser(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	user, ok := findUser(c, db)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already deactivated"})
+		return
+	}
+
+	current, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if current.ID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot deactivate your own account"})
+		return
+	}
+
+	if user.Role == middleware.RoleAdmin && !ensureAnotherActiveAdmin(c, db, user.ID) {
+		return
+	}
+
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("deactivated_at", now).Error; err != nil {
+			return err
+		}
+		return revokeAllSessions(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
+		return
+	}
+
+	logSecurityEvent(c, db, EventUserDeactivated, user.ID, user.Email, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User deactivated successfully",
+		"data":    user,
+	})
+}
+
+// ReactivateUser re-enables a deactivated user account
+func ReactivateUser(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	user, ok := findUser(c, db)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already active"})
+		return
+	}
+
+	if err := db.Model(user).Update("deactivated_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reactivate user"})
+		return
+	}
+	user.DeactivatedAt = nil
+
+	logSecurityEvent(c, db, EventUserReactivated, user.ID, user.Email, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User reactivated successfully",
+		"data":    user,
+	})
+}
+
+// SendPasswordSetEmail emails a user a link to set a new password
+func SendPasswordSetEmail(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	user, ok := findUser(c, cfg.DB)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is deactivated"})
+		return
+	}
+
+	if err := sendPasswordSetEmail(cfg, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	logSecurityEvent(c, cfg.DB, EventPasswordSetEmailSent, user.ID, user.Email, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password setup email sent"})
+}
+
+// ensureAnotherActiveAdmin prevents removing the last active admin, writing a 409 response if it would
+func ensureAnotherActiveAdmin(c *gin.Context, db *gorm.DB, userID uint) bool {
+	var admins int64
+	if err := db.Model(&models.User{}).
+		Where("role = ? AND deactivated_at IS NULL AND id <> ?", middleware.RoleAdmin, userID).
+		Count(&admins).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check admins"})
+		return false
+	}
+	if admins == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "At least one active admin is required"})
+		return false
+	}
+	return true
+}
+
+// sendPasswordSetEmail creates a password reset token for the user and emails a set-password link
+func sendPasswordSetEmail(cfg *config.Config, user *models.User) error {
+	emailCfg := config.LoadEmailConfig()
+
+	token, resetToken, err := createPasswordResetToken(cfg.DB, user.Email, cfg.InviteExpiry)
+	if err != nil {
+		return err
+	}
+
+	setURL := fmt.Sprintf("%s/reset-password?token=%s", cfg.FrontendURL, token)
+	emailBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f8fafc; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 40px; border-radius: 10px;">
+        <h1 style="color: #1e293b; font-size: 24px;">Set your password</h1>
+        <p style="color: #475569; line-height: 1.6;">Hello <strong>%s</strong>,</p>
+        <p style="color: #475569; line-height: 1.6;">An administrator has asked you to set a password for your Inventory System account. Click the button below to choose one:</p>
+        <div style="text-align: center;">
+            <a href="%s" style="display: inline-block; padding: 14px 32px; background-color: #2563eb; color: white; text-decoration: none; border-radius: 8px; font-weight: bold; margin: 20px 0;">Set Password</a>
+        </div>
+        <p style="color: #475569;">This link can be used once and expires on %s.</p>
+        <p style="word-break: break-all; color: #2563eb; font-size: 12px;">%s</p>
+    </div>
+</body>
+</html>
+`, user.Name, setURL, resetToken.ExpiresAt.Format("02 Jan 2006 15:04"), setURL)
+
+	return emailCfg.SendEmail(user.Email, "Set Your Password - Inventory System", emailBody)
 }
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"inventory-backend/config"
+	"inventory-backend/models"
+	"inventory-backend/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// verificationMaxPerHour limits how many verification emails one account can request
+const verificationMaxPerHour = 3
+
+var errInvalidVerificationToken = errors.New("invalid verification token")
+
+// sendVerificationEmail stores a new verification token for the user and emails the confirmation link
+func sendVerificationEmail(cfg *config.Config, user *models.User) error {
+	emailCfg := config.LoadEmailConfig()
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	verification := models.EmailVerification{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(cfg.EmailVerificationExpiry),
+	}
+	if err := cfg.DB.Create(&verification).Error; err != nil {
+		return err
+	}
+
+	verifyURL := fmt.Sprintf("%s/verify-email?token=%s", cfg.FrontendURL, token)
+	emailBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f8fafc; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 40px; border-radius: 10px;">
+        <h1 style="color: #1e293b; font-size: 24px;">Verify your email address</h1>
+        <p style="color: #475569; line-height: 1.6;">Hello <strong>%s</strong>,</p>
+        <p style="color: #475569; line-height: 1.6;">Please confirm that this email address belongs to you by clicking the button below:</p>
+        <div style="text-align: center;">
+            <a href="%s" style="display: inline-block; padding: 14px 32px; background-color: #2563eb; color: white; text-decoration: none; border-radius: 8px; font-weight: bold; margin: 20px 0;">Verify Email</a>
+        </div>
+        <p style="color: #475569;">This link expires on %s.</p>
+        <p style="word-break: break-all; color: #2563eb; font-size: 12px;">%s</p>
+    </div>
+</body>
+</html>
+`, user.Name, verifyURL, verification.ExpiresAt.Format("02 Jan 2006 15:04"), verifyURL)
+
+	return emailCfg.SendEmail(user.Email, "Verify Your Email - Inventory System", emailBody)
+}
+
+// VerifyEmailRequest holds the verification token from the emailed link
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail marks the user's email address as verified
+func VerifyEmail(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := cfg.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var verification models.EmailVerification
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(req.Token), now).
+			First(&verification).Error; err != nil {
+			return errInvalidVerificationToken
+		}
+
+		result := tx.Model(&models.EmailVerification{}).
+			Where("id = ? AND used_at IS NULL", verification.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidVerificationToken
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", verification.UserID).
+			Update("email_verified_at", now).Error
+	})
+	if errors.Is(err, errInvalidVerificationToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationRequest holds the email to resend the verification link to
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResendVerification sends a fresh verification link to an unverified account
+func ResendVerification(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Respond the same way whether or not the account exists or is already verified
+	response := gin.H{"message": "If the account exists and is not verified, a verification link has been sent"}
+
+	var user models.User
+	if err := cfg.DB.Where("email = ? AND email_verified_at IS NULL AND deactivated_at IS NULL", req.Email).
+		First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	var recent int64
+	if err := cfg.DB.Model(&models.EmailVerification{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-time.Hour)).
+		Count(&recent).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check verification requests"})
+		return
+	}
+	if recent >= verificationMaxPerHour {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	if err := sendVerificationEmail(cfg, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
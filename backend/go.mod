@@ -3,9 +3,13 @@ module inventory-backend
 go 1.25.0
 
 require (
+	github.com/boombuler/barcode v1.1.0
 	github.com/gin-gonic/gin v1.11.0
+	github.com/go-pdf/fpdf v0.9.0
+	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/joho/godotenv v1.5.1
 	golang.org/x/crypto v0.48.0
+	golang.org/x/image v0.35.0
 	gorm.io/driver/postgres v1.5.7
 	gorm.io/gorm v1.25.7
 )
@@ -13,6 +13,10 @@ func main() {
 	cfg := config.Load()
 	globalConfig = cfg
 
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Initialize database connection
 	if err := cfg.InitDB(); err != nil {
 		log.Fatalf("Database initialization failed: %v", err)
@@ -23,6 +27,11 @@ func main() {
 		log.Fatalf("Database migration failed: %v", err)
 	}
 
+	// Initialize file storage
+	if err := cfg.InitStorage(); err != nil {
+		log.Fatalf("Storage initialization failed: %v", err)
+	}
+
 	// Test connection
 	if connected, err := cfg.TestConnection(); err != nil {
 		log.Fatalf("Database connection test failed: %v", err)
@@ -3,13 +3,32 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
+
+	"inventory-backend/config"
+	"inventory-backend/models"
+	"inventory-backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthRequired is a placeholder JWT authentication middleware
-func AuthRequired() gin.HandlerFunc {
+// APIKeyPrefix starts every generated API key so it can be told apart from a JWT
+const APIKeyPrefix = "inv_"
+
+// apiKeyTouchInterval limits how often last_used_at is written for busy keys
+const apiKeyTouchInterval = time.Minute
+
+// sessionTouchInterval limits how often a session's last_seen_at is written
+const sessionTouchInterval = time.Minute
+
+// AuthRequired validates the JWT bearer token or API key and loads the authenticated user into the context
+func AuthRequired(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(c, cfg, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
@@ -26,8 +45,6 @@ func AuthRequired() gin.HandlerFunc {
 			return
 		}
 
-		// TODO: Validate JWT token from parts[1]
-		// For now, just pass through if token is present
 		token := parts[1]
 		if token == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
@@ -36,8 +53,117 @@ func AuthRequired() gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(token, APIKeyPrefix) {
+			authenticateAPIKey(c, cfg, token)
+			return
+		}
+
+		claims, err := utils.ParseToken(cfg.JWTSecret, token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or expired token",
+			})
+			return
+		}
+
+		// Reject access tokens whose session was revoked by logout or by an admin
+		var session models.RefreshToken
+		if err := cfg.DB.Where("family_id = ? AND user_id = ? AND revoked_at IS NULL", claims.SessionID, claims.UserID).
+			Order("id DESC").First(&session).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Session has been revoked",
+			})
+			return
+		}
+
+		// Resolve the user so that deactivations and role changes take effect immediately
+		var user models.User
+		if err := cfg.DB.Where("deactivated_at IS NULL").First(&user, claims.UserID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "User not found or deactivated",
+			})
+			return
+		}
+
+		now := time.Now()
+		if session.LastSeenAt == nil || now.Sub(*session.LastSeenAt) > sessionTouchInterval {
+			cfg.DB.Model(&session).Updates(map[string]interface{}{
+				"last_seen_at": now,
+				"ip_address":   c.ClientIP(),
+			})
+		}
+
 		// Set user info in context after validation
 		c.Set("token", token)
+		c.Set("session_id", claims.SessionID)
+		c.Set("user", &user)
+		c.Next()
+	}
+}
+
+// authenticateAPIKey resolves an API key to its owner and continues the chain, or aborts with 401
+func authenticateAPIKey(c *gin.Context, cfg *config.Config, rawKey string) {
+	var key models.APIKey
+	if err := cfg.DB.Where("key_hash = ?", utils.HashToken(rawKey)).First(&key).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid API key",
+		})
+		return
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "API key has expired or been revoked",
+		})
+		return
+	}
+
+	var user models.User
+	if err := cfg.DB.Where("deactivated_at IS NULL").First(&user, key.UserID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "API key owner not found or deactivated",
+		})
+		return
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		cfg.DB.Model(&key).Update("last_used_at", now)
+	}
+
+	c.Set("api_key", &key)
+	c.Set("user", &user)
+	c.Next()
+}
+
+// TwoFactorEnrolled blocks admins without 2FA when REQUIRE_ADMIN_2FA is enabled.
+// It must run after AuthRequired.
+func TwoFactorEnrolled(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.RequireAdmin2FA {
+			c.Next()
+			return
+		}
+
+		user, ok := authenticatedUser(c)
+		if !ok {
+			return
+		}
+
+		// API keys are non-interactive and cannot complete a second factor
+		if _, isAPIKey := c.Get("api_key"); isAPIKey {
+			c.Next()
+			return
+		}
+
+		if user.Role == RoleAdmin && !user.TOTPEnabled {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":                     "Two-factor authentication must be enabled for admin accounts",
+				"two_factor_setup_required": true,
+			})
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"net/http"
+
+	"inventory-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles stored in models.User.Role
+const (
+	RoleAdmin = "admin"
+	RoleStaff = "staff"
+)
+
+// Permissions checked by RequirePermission
+const (
+	PermProductRead    = "product:read"
+	PermProductWrite   = "product:write"
+	PermProductDelete  = "product:delete"
+	PermStockRead      = "stock:read"
+	PermTransaction    = "transaction:create"
+	PermOpnameCreate   = "opname:create"
+	PermOpnameApprove  = "opname:approve"
+	PermGudangRead     = "gudang:read"
+	PermUserManage     = "user:manage"
+	PermAPIKeyManage   = "apikey:manage"
+	PermAuditRead      = "audit:read"
+	PermCategoryManage = "category:manage"
+	PermUnitManage     = "unit:manage"
+)
+
+// rolePermissions is the permission matrix for each role
+var rolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermProductRead,
+		PermProductWrite,
+		PermProductDelete,
+		PermStockRead,
+		PermTransaction,
+		PermOpnameCreate,
+		PermOpnameApprove,
+		PermGudangRead,
+		PermUserManage,
+		PermAPIKeyManage,
+		PermAuditRead,
+		PermCategoryManage,
+		PermUnitManage,
+	},
+	RoleStaff: {
+		PermProductRead,
+		PermProductWrite,
+		PermStockRead,
+		PermTransaction,
+		PermOpnameCreate,
+		PermGudangRead,
+	},
+}
+
+// HasPermission reports whether a role is granted a permission
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole allows the request only if the authenticated user has one of the given roles.
+// It must run after AuthRequired.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := authenticatedUser(c)
+		if !ok {
+			return
+		}
+
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "You do not have access to this resource",
+		})
+	}
+}
+
+// RequirePermission allows the request only if the authenticated user's role grants the permission.
+// It must run after AuthRequired.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := authenticatedUser(c)
+		if !ok {
+			return
+		}
+
+		if !HasPermission(user.Role, permission) || !apiKeyAllows(c, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":      "You do not have permission to perform this action",
+				"permission": permission,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RejectAPIKey blocks API keys from account self-service routes, which only the user's own session may use
+func RejectAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAPIKey := c.Get("api_key"); isAPIKey {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "This endpoint cannot be used with an API key",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// IsValidPermission reports whether a permission name exists; admins are granted every permission
+func IsValidPermission(permission string) bool {
+	return HasPermission(RoleAdmin, permission)
+}
+
+// apiKeyAllows checks the scopes of the API key used for the request, if any
+func apiKeyAllows(c *gin.Context, permission string) bool {
+	value, ok := c.Get("api_key")
+	if !ok {
+		return true
+	}
+
+	key, ok := value.(*models.APIKey)
+	if !ok || len(key.Permissions) == 0 {
+		return ok
+	}
+
+	for _, p := range key.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func authenticatedUser(c *gin.Context) (*models.User, bool) {
+	value, _ := c.Get("user")
+	user, ok := value.(*models.User)
+	if !ok || user == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return nil, false
+	}
+	return user, true
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // User represents a system user
 type User struct {
@@ -10,18 +14,141 @@ type User struct {
 	Password  string    `gorm:"type:varchar(255)" json:"-"`
 	Role      string    `gorm:"type:varchar(20)" json:"role"` // admin, staff
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	DeactivatedAt   *time.Time `gorm:"index" json:"deactivated_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	LastLoginAt       *time.Time `json:"last_login_at"`
+	LastFailedLoginAt *time.Time `json:"last_failed_login_at"`
+	FailedLoginCount  int        `gorm:"default:0" json:"failed_login_count"`
+	LockedUntil       *time.Time `json:"locked_until"`
+
+	TOTPSecret   string `gorm:"type:varchar(64)" json:"-"`
+	TOTPEnabled  bool   `gorm:"default:false" json:"totp_enabled"`
+	TOTPLastStep int64  `gorm:"default:0" json:"-"`
+
+	// OIDCSubject links the account to an identity at the SSO provider
+	OIDCSubject *string `gorm:"type:varchar(255);uniqueIndex" json:"-"`
+}
+
+// OIDCLoginState tracks a pending SSO login between the authorization redirect and the callback
+type OIDCLoginState struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	StateHash    string    `gorm:"type:varchar(64);unique" json:"-"`
+	Nonce        string    `gorm:"type:varchar(64)" json:"-"`
+	CodeVerifier string    `gorm:"type:varchar(128)" json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PasswordHistory keeps previous password hashes so they cannot be reused
+type PasswordHistory struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"index" json:"user_id"`
+	PasswordHash string    `gorm:"type:varchar(255)" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RecoveryCode is a single-use backup code for two-factor authentication
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	CodeHash  string     `gorm:"type:varchar(64)" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// SecurityEvent is an entry in the authentication and security audit log
+type SecurityEvent struct {
+	ID        uint                   `gorm:"primaryKey" json:"id"`
+	EventType string                 `gorm:"type:varchar(50);index" json:"event_type"`
+	UserID    *uint                  `gorm:"index" json:"user_id"`
+	ActorID   *uint                  `json:"actor_id"`
+	Email     string                 `gorm:"type:varchar(100)" json:"email"`
+	IPAddress string                 `gorm:"type:varchar(45)" json:"ip_address"`
+	UserAgent string                 `gorm:"type:varchar(255)" json:"user_agent"`
+	Details   map[string]interface{} `gorm:"serializer:json;type:text" json:"details"`
+	CreatedAt time.Time              `gorm:"index" json:"created_at"`
+}
+
+// LoginAttempt records a login attempt for per-IP throttling
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"type:varchar(100)" json:"email"`
+	IPAddress string    `gorm:"type:varchar(45);index:idx_login_attempt_ip" json:"ip_address"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `gorm:"index:idx_login_attempt_ip" json:"created_at"`
 }
 
 // PasswordReset represents a password reset token
 type PasswordReset struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Email     string    `gorm:"type:varchar(100);index" json:"email"`
-	Token     string    `gorm:"type:varchar(255);unique" json:"token"`
+	TokenHash string    `gorm:"type:varchar(64);unique" json:"-"`
 	ExpiresAt time.Time `json:"expires_at"`
 	Used      bool      `gorm:"default:false" json:"used"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// EmailVerification represents a token proving ownership of a user's email address
+type EmailVerification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	TokenHash string     `gorm:"type:varchar(64);unique" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Invitation represents an admin-issued invite to create an account
+type Invitation struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Email      string     `gorm:"type:varchar(100);index" json:"email"`
+	Role       string     `gorm:"type:varchar(20)" json:"role"`
+	GudangID   *uint      `json:"gudang_id"`
+	TokenHash  string     `gorm:"type:varchar(64);unique" json:"-"`
+	InvitedBy  uint       `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RefreshToken represents a rotating refresh token; tokens issued from the same login share a FamilyID
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	FamilyID  string     `gorm:"type:varchar(64);index" json:"family_id"`
+	TokenHash string     `gorm:"type:varchar(64);unique" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `gorm:"index" json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Session details, carried over on every rotation so the family describes one login
+	SessionStartedAt time.Time  `json:"session_started_at"`
+	LastSeenAt       *time.Time `json:"last_seen_at"`
+	IPAddress        string     `gorm:"type:varchar(45)" json:"ip_address"`
+	UserAgent        string     `gorm:"type:varchar(255)" json:"user_agent"`
+}
+
+// APIKey is a long-lived credential for scanners and integrations, acting on behalf of its owner.
+// Empty Permissions or GudangIDs mean no restriction beyond the owner's own access.
+type APIKey struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Name        string     `gorm:"type:varchar(100)" json:"name"`
+	Prefix      string     `gorm:"type:varchar(16)" json:"prefix"`
+	KeyHash     string     `gorm:"type:varchar(64);unique" json:"-"`
+	UserID      uint       `gorm:"index" json:"user_id"`
+	Permissions []string   `gorm:"type:text;serializer:json" json:"permissions"`
+	GudangIDs   []uint     `gorm:"type:text;serializer:json" json:"gudang_ids"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedBy   uint       `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
 // Product represents an inventory item
 type Product struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
@@ -45,12 +172,95 @@ type Produk struct {
 	Satuan      string  `gorm:"type:varchar(50);column:satuan" json:"satuan"`
 	StokMinimal int     `gorm:"default:0;column:stok_minimal" json:"stok_minimal"`
 	BeratKg     float64 `gorm:"default:0;column:berat_kg" json:"berat_kg"`
+	KategoriID  *uint   `gorm:"index;column:kategori_id" json:"kategori_id"`
+	// Deleted products are kept so stock and transaction history stay linked, and can be restored
+	DeletedAt gorm.DeletedAt `gorm:"index;column:deleted_at" json:"deleted_at,omitempty"`
 }
 
 func (Produk) TableName() string {
 	return "produk"
 }
 
+// Category is a node in the product category tree mapped to "kategori" table
+type Category struct {
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	Nama      string    `gorm:"type:varchar(100);column:nama" json:"nama"`
+	ParentID  *uint     `gorm:"index;column:parent_id" json:"parent_id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Category) TableName() string {
+	return "kategori"
+}
+
+// Unit is a unit of measure in the "satuan" master table; Produk.Satuan holds the code of a product's base unit
+type Unit struct {
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	Kode      string    `gorm:"type:varchar(20);column:kode" json:"kode"`
+	Nama      string    `gorm:"type:varchar(50);column:nama" json:"nama"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Unit) TableName() string {
+	return "satuan"
+}
+
+// ProductUnit converts an alternative unit of a product to its base unit, mapped to "produk_satuan" table.
+// Faktor is the number of base units in one of this unit, e.g. 24 for 1 box = 24 pcs.
+type ProductUnit struct {
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	ProdukID  uint      `gorm:"uniqueIndex:idx_produk_satuan;column:produk_id" json:"produk_id"`
+	SatuanID  uint      `gorm:"uniqueIndex:idx_produk_satuan;column:satuan_id" json:"satuan_id"`
+	Satuan    *Unit     `gorm:"foreignKey:SatuanID" json:"satuan,omitempty"`
+	Faktor    int       `gorm:"column:faktor" json:"faktor"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (ProductUnit) TableName() string {
+	return "produk_satuan"
+}
+
+// ProductBarcode is a barcode printed on a product, mapped to "produk_barcode" table.
+// A barcode may identify a packaging unit (e.g. the EAN-13 on a box), in which case SatuanID is set.
+type ProductBarcode struct {
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	ProdukID  uint      `gorm:"index;column:produk_id" json:"produk_id"`
+	Kode      string    `gorm:"type:varchar(100);uniqueIndex;column:kode" json:"kode"`
+	Jenis     string    `gorm:"type:varchar(20);column:jenis" json:"jenis"` // ean13, code128 or internal
+	SatuanID  *uint     `gorm:"column:satuan_id" json:"satuan_id"`
+	Satuan    *Unit     `gorm:"foreignKey:SatuanID" json:"satuan,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (ProductBarcode) TableName() string {
+	return "produk_barcode"
+}
+
+// ProductAttachment is a photo or document attached to a product, mapped to "produk_lampiran" table.
+// The file itself lives in the configured storage under StorageKey.
+type ProductAttachment struct {
+	ID           uint      `gorm:"primaryKey;column:id" json:"id"`
+	ProdukID     uint      `gorm:"index;column:produk_id" json:"produk_id"`
+	Jenis        string    `gorm:"type:varchar(20);column:jenis" json:"jenis"` // image or document
+	NamaFile     string    `gorm:"type:varchar(255);column:nama_file" json:"nama_file"`
+	ContentType  string    `gorm:"type:varchar(100);column:content_type" json:"content_type"`
+	Ukuran       int64     `gorm:"column:ukuran" json:"ukuran"`
+	StorageKey   string    `gorm:"type:varchar(255);column:storage_key" json:"-"`
+	ThumbnailKey string    `gorm:"type:varchar(255);column:thumbnail_key" json:"-"`
+	UploadedBy   *uint     `gorm:"column:uploaded_by" json:"uploaded_by"`
+	CreatedAt    time.Time `gorm:"column:created_at" json:"created_at"`
+
+	URL          string `gorm:"-" json:"url"`
+	ThumbnailURL string `gorm:"-" json:"thumbnail_url,omitempty"`
+}
+
+func (ProductAttachment) TableName() string {
+	return "produk_lampiran"
+}
+
 // StockCard represents a stock movement record
 type StockCard struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
@@ -93,15 +303,19 @@ func (StockGudang) TableName() string {
 
 // Transaction represents inventory movement transaction mapped to "transaksi" table
 type Transaction struct {
-	ID              uint      `gorm:"primaryKey;column:id" json:"id"`
-	ProdukID        uint      `gorm:"index;column:produk_id" json:"produk_id"`
-	GudangID        uint      `gorm:"index;column:gudang_id" json:"gudang_id"`
-	UserID          uint      `gorm:"index;column:user_id" json:"user_id"`
-	Tipe            string    `gorm:"type:varchar(20);column:tipe" json:"tipe"` // "masuk" or "keluar"
-	Jumlah          int       `gorm:"column:jumlah" json:"jumlah"`
-	Tanggal         time.Time `gorm:"column:tanggal" json:"tanggal"`
-	CreatedAt       time.Time `gorm:"column:created_at" json:"created_at"`
-	UpdatedAt       time.Time `gorm:"column:updated_at" json:"updated_at"`
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	ProdukID  uint      `gorm:"index;column:produk_id" json:"produk_id"`
+	GudangID  uint      `gorm:"index;column:gudang_id" json:"gudang_id"`
+	UserID    uint      `gorm:"index;column:user_id" json:"user_id"`
+	Tipe      string    `gorm:"type:varchar(20);column:tipe" json:"tipe"` // "masuk" or "keluar"
+	Jumlah    int       `gorm:"column:jumlah" json:"jumlah"`              // in the product's base unit
+	Tanggal   time.Time `gorm:"column:tanggal" json:"tanggal"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+
+	// Quantity and unit as entered, before conversion to the base unit
+	JumlahInput int    `gorm:"column:jumlah_input" json:"jumlah_input"`
+	SatuanInput string `gorm:"type:varchar(20);column:satuan_input" json:"satuan_input"`
 }
 
 func (Transaction) TableName() string {
@@ -120,19 +334,31 @@ func (Gudang) TableName() string {
 	return "gudang"
 }
 
+// UserGudang assigns a user to a warehouse they may work in, mapped to "user_gudang" table
+type UserGudang struct {
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_user_gudang;column:user_id" json:"user_id"`
+	GudangID  uint      `gorm:"uniqueIndex:idx_user_gudang;column:gudang_id" json:"gudang_id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (UserGudang) TableName() string {
+	return "user_gudang"
+}
+
 // StockOpname represents stock opname records mapped to "stok_opname" table
 type StockOpname struct {
-	ID              uint      `gorm:"primaryKey;column:id" json:"id"`
-	ProdukID        uint      `gorm:"index;column:produk_id" json:"produk_id"`
-	StokSistem      int       `gorm:"column:stok_sistem" json:"stok_sistem"`
-	StokFisik       int       `gorm:"column:stok_fisik" json:"stok_fisik"`
-	Selisih         int       `gorm:"column:selisih" json:"selisih"`
-	UserID          uint      `gorm:"index;column:user_id" json:"user_id"`
-	Keterangan      string    `gorm:"type:text;column:keterangan" json:"keterangan"`
-	SudahDisetujui  bool      `gorm:"default:false;column:sudah_disetujui" json:"sudah_disetujui"`
-	Tanggal         time.Time `gorm:"column:tanggal" json:"tanggal"`
-	CreatedAt       time.Time `gorm:"column:created_at" json:"created_at"`
-	UpdatedAt       time.Time `gorm:"column:updated_at" json:"updated_at"`
+	ID             uint      `gorm:"primaryKey;column:id" json:"id"`
+	ProdukID       uint      `gorm:"index;column:produk_id" json:"produk_id"`
+	StokSistem     int       `gorm:"column:stok_sistem" json:"stok_sistem"`
+	StokFisik      int       `gorm:"column:stok_fisik" json:"stok_fisik"`
+	Selisih        int       `gorm:"column:selisih" json:"selisih"`
+	UserID         uint      `gorm:"index;column:user_id" json:"user_id"`
+	Keterangan     string    `gorm:"type:text;column:keterangan" json:"keterangan"`
+	SudahDisetujui bool      `gorm:"default:false;column:sudah_disetujui" json:"sudah_disetujui"`
+	Tanggal        time.Time `gorm:"column:tanggal" json:"tanggal"`
+	CreatedAt      time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"column:updated_at" json:"updated_at"`
 }
 
 func (StockOpname) TableName() string {
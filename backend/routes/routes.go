@@ -58,11 +58,46 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 				c.Set("config", cfg)
 				controllers.Login(c)
 			})
-			auth.POST("/logout", controllers.Logout)
+			auth.POST("/refresh", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.Refresh(c)
+			})
+			auth.POST("/login/2fa", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.LoginTwoFactor(c)
+			})
+			auth.GET("/oidc/login", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.OIDCLogin(c)
+			})
+			auth.POST("/oidc/callback", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.OIDCCallback(c)
+			})
+			auth.POST("/logout", middleware.AuthRequired(cfg), middleware.RejectAPIKey(), func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.Logout(c)
+			})
+			auth.POST("/logout-all", middleware.AuthRequired(cfg), middleware.RejectAPIKey(), func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.LogoutAll(c)
+			})
 			auth.POST("/register", func(c *gin.Context) {
 				c.Set("config", cfg)
 				controllers.Register(c)
 			})
+			auth.POST("/verify-email", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.VerifyEmail(c)
+			})
+			auth.POST("/resend-verification", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.ResendVerification(c)
+			})
+			auth.POST("/accept-invite", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.AcceptInvitation(c)
+			})
 			auth.POST("/forgot-password", func(c *gin.Context) {
 				c.Set("config", cfg)
 				controllers.ForgotPassword(c)
@@ -73,14 +108,62 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 			})
 		}
 
+		// Two-factor enrollment (available before 2FA is enabled)
+		twoFactor := api.Group("/2fa")
+		twoFactor.Use(middleware.AuthRequired(cfg), middleware.RejectAPIKey())
+		{
+			twoFactor.POST("/setup", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.SetupTwoFactor(c)
+			})
+			twoFactor.POST("/enable", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.EnableTwoFactor(c)
+			})
+			twoFactor.POST("/disable", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.DisableTwoFactor(c)
+			})
+			twoFactor.POST("/recovery-codes", func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.RegenerateRecoveryCodes(c)
+			})
+		}
+
 		// Protected routes
 		protected := api.Group("/")
-		protected.Use(middleware.AuthRequired())
+		protected.Use(middleware.AuthRequired(cfg), middleware.TwoFactorEnrolled(cfg))
 		{
+			// Self-service profile
+			me := protected.Group("/me")
+			me.Use(middleware.RejectAPIKey())
+			{
+				me.GET("", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetMe(c)
+				})
+				me.PUT("", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.UpdateMe(c)
+				})
+				me.POST("/password", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.ChangePassword(c)
+				})
+				me.GET("/sessions", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetMySessions(c)
+				})
+				me.DELETE("/sessions/:sessionId", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.RevokeMySession(c)
+				})
+			}
+
 			// Gudang / Warehouse management
 			gudangs := protected.Group("/gudangs")
 			{
-				gudangs.GET("", func(c *gin.Context) {
+				gudangs.GET("", middleware.RequirePermission(middleware.PermGudangRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetGudangs(c)
 				})
@@ -88,78 +171,292 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 
 			// User management
 			users := protected.Group("/users")
+			users.Use(middleware.RequirePermission(middleware.PermUserManage))
 			{
-				users.GET("", controllers.GetUsers)
-				users.GET("/:id", controllers.GetUser)
-				users.POST("", controllers.CreateUser)
-				users.DELETE("/:id", controllers.DeleteUser)
+				users.GET("", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetUsers(c)
+				})
+				users.GET("/:id", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetUser(c)
+				})
+				users.POST("", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.CreateUser(c)
+				})
+				users.PUT("/:id", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.UpdateUser(c)
+				})
+				users.DELETE("/:id", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.DeactivateUser(c)
+				})
+				users.POST("/:id/reactivate", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.ReactivateUser(c)
+				})
+				users.POST("/:id/password-email", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.SendPasswordSetEmail(c)
+				})
+				users.POST("/:id/unlock", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.UnlockUser(c)
+				})
+				users.GET("/:id/gudangs", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetUserGudangs(c)
+				})
+				users.PUT("/:id/gudangs", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.SetUserGudangs(c)
+				})
+				users.GET("/:id/sessions", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetUserSessions(c)
+				})
+				users.DELETE("/:id/sessions/:sessionId", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.RevokeUserSession(c)
+				})
+				users.POST("/:id/logout", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.ForceLogoutUser(c)
+				})
+			}
+
+			// Security audit log
+			protected.GET("/security-events", middleware.RequirePermission(middleware.PermAuditRead), func(c *gin.Context) {
+				c.Set("config", cfg)
+				controllers.GetSecurityEvents(c)
+			})
+
+			// Invitations
+			invitations := protected.Group("/invitations")
+			invitations.Use(middleware.RequirePermission(middleware.PermUserManage))
+			{
+				invitations.GET("", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetInvitations(c)
+				})
+				invitations.POST("", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.CreateInvitation(c)
+				})
+				invitations.DELETE("/:id", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.DeleteInvitation(c)
+				})
+			}
+
+			// API keys for scanners and integrations
+			apiKeys := protected.Group("/api-keys")
+			apiKeys.Use(middleware.RequirePermission(middleware.PermAPIKeyManage))
+			{
+				apiKeys.GET("", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetAPIKeys(c)
+				})
+				apiKeys.POST("", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.CreateAPIKey(c)
+				})
+				apiKeys.DELETE("/:id", func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.RevokeAPIKey(c)
+				})
 			}
 
 			// Product / Item management
 			products := protected.Group("/products")
 			{
-				products.GET("", func(c *gin.Context) {
+				products.GET("", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetProducts(c)
 				})
-				products.GET("/:id", func(c *gin.Context) {
+				// Cleaning up duplicates means deleting products, so the report is limited to the same role
+				products.GET("/duplicates", middleware.RequirePermission(middleware.PermProductDelete), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetDuplicateProducts(c)
+				})
+				products.GET("/:id", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetProduct(c)
 				})
-				products.GET("/stock/:produk_id", func(c *gin.Context) {
+				products.POST("/import", middleware.RequirePermission(middleware.PermProductWrite), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.ImportProducts(c)
+				})
+				products.POST("/:id/restore", middleware.RequirePermission(middleware.PermProductDelete), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.RestoreProduct(c)
+				})
+				products.POST("/labels", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.PrintProductLabels(c)
+				})
+				products.GET("/:id/label", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetProductLabel(c)
+				})
+				products.GET("/by-barcode/:code", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetProductByBarcode(c)
+				})
+				products.GET("/:id/barcodes", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetProductBarcodes(c)
+				})
+				products.POST("/:id/barcodes", middleware.RequirePermission(middleware.PermProductWrite), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.AddProductBarcode(c)
+				})
+				products.DELETE("/:id/barcodes/:barcodeId", middleware.RequirePermission(middleware.PermProductWrite), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.DeleteProductBarcode(c)
+				})
+				products.GET("/:id/attachments", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetProductAttachments(c)
+				})
+				products.POST("/:id/attachments", middleware.RequirePermission(middleware.PermProductWrite), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.UploadProductAttachment(c)
+				})
+				products.GET("/:id/attachments/:attachmentId/file", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.DownloadProductAttachment(c)
+				})
+				products.DELETE("/:id/attachments/:attachmentId", middleware.RequirePermission(middleware.PermProductWrite), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.DeleteProductAttachment(c)
+				})
+				products.GET("/:id/units", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetProductUnits(c)
+				})
+				products.PUT("/:id/units/:satuanId", middleware.RequirePermission(middleware.PermProductWrite), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.SetProductUnit(c)
+				})
+				products.DELETE("/:id/units/:satuanId", middleware.RequirePermission(middleware.PermProductWrite), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.DeleteProductUnit(c)
+				})
+				products.GET("/stock/:produk_id", middleware.RequirePermission(middleware.PermStockRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetProductTotalStock(c)
 				})
-				products.POST("", func(c *gin.Context) {
+				products.POST("", middleware.RequirePermission(middleware.PermProductWrite), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.CreateProduct(c)
 				})
-				products.PUT("/:id", func(c *gin.Context) {
+				products.PUT("/:id", middleware.RequirePermission(middleware.PermProductWrite), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.UpdateProduct(c)
 				})
-				products.DELETE("/:id", func(c *gin.Context) {
+				products.DELETE("/:id", middleware.RequirePermission(middleware.PermProductDelete), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.DeleteProduct(c)
 				})
 			}
 
+			// Product categories
+			categories := protected.Group("/categories")
+			{
+				categories.GET("", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetCategories(c)
+				})
+				categories.GET("/:id", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetCategory(c)
+				})
+				categories.POST("", middleware.RequirePermission(middleware.PermCategoryManage), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.CreateCategory(c)
+				})
+				categories.PUT("/:id", middleware.RequirePermission(middleware.PermCategoryManage), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.UpdateCategory(c)
+				})
+				categories.DELETE("/:id", middleware.RequirePermission(middleware.PermCategoryManage), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.DeleteCategory(c)
+				})
+				categories.POST("/:id/merge", middleware.RequirePermission(middleware.PermCategoryManage), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.MergeCategory(c)
+				})
+			}
+
+			// Units of measure
+			units := protected.Group("/units")
+			{
+				units.GET("", middleware.RequirePermission(middleware.PermProductRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetUnits(c)
+				})
+				units.POST("", middleware.RequirePermission(middleware.PermUnitManage), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.CreateUnit(c)
+				})
+				units.PUT("/:id", middleware.RequirePermission(middleware.PermUnitManage), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.UpdateUnit(c)
+				})
+				units.DELETE("/:id", middleware.RequirePermission(middleware.PermUnitManage), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.DeleteUnit(c)
+				})
+			}
+
 			// Stock / Opname
 			stock := protected.Group("/stock")
 			{
-				stock.GET("", func(c *gin.Context) {
+				stock.GET("", middleware.RequirePermission(middleware.PermStockRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetStockCards(c)
 				})
-				stock.GET("/:id", func(c *gin.Context) {
+				stock.GET("/by-category", middleware.RequirePermission(middleware.PermStockRead), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.GetStockByCategory(c)
+				})
+				stock.GET("/:id", middleware.RequirePermission(middleware.PermStockRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetStockCard(c)
 				})
 				
 				// Stock Opname endpoints
-				stock.POST("/opname", func(c *gin.Context) {
+				stock.POST("/opname", middleware.RequirePermission(middleware.PermOpnameCreate), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.CreateStockOpname(c)
 				})
-				stock.GET("/opname", func(c *gin.Context) {
+				stock.GET("/opname", middleware.RequirePermission(middleware.PermStockRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetStockOpnames(c)
 				})
-				stock.GET("/opname/:id", func(c *gin.Context) {
+				stock.GET("/opname/:id", middleware.RequirePermission(middleware.PermStockRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetStockOpnameByID(c)
 				})
+				stock.PUT("/opname/:id/approve", middleware.RequirePermission(middleware.PermOpnameApprove), func(c *gin.Context) {
+					c.Set("config", cfg)
+					controllers.ApproveStockOpname(c)
+				})
 				
 				// Transaction endpoints
-				stock.POST("/transactions", func(c *gin.Context) {
+				stock.POST("/transactions", middleware.RequirePermission(middleware.PermTransaction), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.CreateTransaction(c)
 				})
-				stock.GET("/transactions", func(c *gin.Context) {
+				stock.GET("/transactions", middleware.RequirePermission(middleware.PermStockRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetTransactions(c)
 				})
-				stock.GET("/transactions/:id", func(c *gin.Context) {
+				stock.GET("/transactions/:id", middleware.RequirePermission(middleware.PermStockRead), func(c *gin.Context) {
 					c.Set("config", cfg)
 					controllers.GetTransaction(c)
 				})
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+
+	// Decoders for the image formats accepted as attachments
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Attachment kinds
+const (
+	AttachmentImage    = "image"
+	AttachmentDocument = "document"
+)
+
+// attachmentTypes maps the accepted content types, as sniffed from the file itself, to their kind
+var attachmentTypes = map[string]string{
+	"image/jpeg":      AttachmentImage,
+	"image/png":       AttachmentImage,
+	"image/gif":       AttachmentImage,
+	"image/webp":      AttachmentImage,
+	"application/pdf": AttachmentDocument,
+}
+
+// maxImagePixels rejects images that would take excessive memory to decode for a thumbnail
+const maxImagePixels = 50_000_000
+
+// DetectAttachmentType sniffs the content type from the file's bytes rather than trusting the client.
+// It returns the content type and attachment kind, or an error if the type is not accepted.
+func DetectAttachmentType(data []byte) (contentType, kind string, err error) {
+	contentType = http.DetectContentType(data)
+	kind, ok := attachmentTypes[contentType]
+	if !ok {
+		return contentType, "", fmt.Errorf("file type %s is not allowed, upload a JPEG, PNG, GIF or WebP image or a PDF", contentType)
+	}
+	return contentType, kind, nil
+}
+
+// MakeThumbnail scales an image down to fit a maxSide square and encodes it as JPEG.
+// Transparent areas are flattened onto white.
+func MakeThumbnail(data []byte, maxSide int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, errors.New("image dimensions are too large")
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			w, h = maxSide, max(1, h*maxSide/w)
+		} else {
+			w, h = max(1, w*maxSide/h), maxSide
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
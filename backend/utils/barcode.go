@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Barcode symbologies supported for products
+const (
+	BarcodeEAN13    = "ean13"
+	BarcodeCode128  = "code128"
+	BarcodeInternal = "internal"
+)
+
+// BarcodeTypes lists the accepted values for a barcode's jenis
+var BarcodeTypes = []string{BarcodeEAN13, BarcodeCode128, BarcodeInternal}
+
+const (
+	maxCode128Length  = 80
+	maxInternalLength = 64
+)
+
+// NormalizeBarcode trims a scanned or typed barcode and validates it for the given symbology.
+// EAN-13 codes must carry a correct check digit; Code128 data may be any printable ASCII since its
+// checksum is part of the symbol and never reaches the application.
+func NormalizeBarcode(kind, code string) (string, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return "", errors.New("barcode is empty")
+	}
+
+	switch kind {
+	case BarcodeEAN13:
+		if len(code) != 13 || !isDigits(code) {
+			return "", errors.New("EAN-13 barcode must be exactly 13 digits")
+		}
+		if want := EAN13CheckDigit(code[:12]); int(code[12]-'0') != want {
+			return "", fmt.Errorf("invalid EAN-13 check digit, expected %d", want)
+		}
+	case BarcodeCode128:
+		if len(code) > maxCode128Length {
+			return "", fmt.Errorf("Code128 barcode must be at most %d characters", maxCode128Length)
+		}
+		for _, r := range code {
+			if r < 32 || r > 126 {
+				return "", errors.New("Code128 barcode may only contain printable ASCII characters")
+			}
+		}
+	case BarcodeInternal:
+		if len(code) > maxInternalLength {
+			return "", fmt.Errorf("internal barcode must be at most %d characters", maxInternalLength)
+		}
+		for _, r := range code {
+			if !isInternalBarcodeChar(r) {
+				return "", errors.New("internal barcode may only contain letters, digits, '-', '_' and '.'")
+			}
+		}
+	default:
+		return "", fmt.Errorf("unknown barcode type %q, use one of %s", kind, strings.Join(BarcodeTypes, ", "))
+	}
+
+	return code, nil
+}
+
+// EAN13CheckDigit computes the check digit for the first 12 digits of an EAN-13 code
+func EAN13CheckDigit(digits string) int {
+	sum := 0
+	for i, r := range digits {
+		d := int(r - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+// InternalEAN13 builds an EAN-13 code in the restricted-circulation range (prefix 20) for a product ID,
+// so products without a manufacturer barcode can still be labelled and scanned
+func InternalEAN13(produkID uint) string {
+	body := fmt.Sprintf("20%010d", produkID)
+	return fmt.Sprintf("%s%d", body, EAN13CheckDigit(body))
+}
+
+// BarcodeLookupCandidates returns the stored codes a scan may correspond to. Scanners configured for
+// UPC-A drop the leading zero of EAN-13 codes starting with 0, so a 12-digit scan also matches with it restored.
+func BarcodeLookupCandidates(scanned string) []string {
+	code := strings.TrimSpace(scanned)
+	candidates := []string{code}
+	if len(code) == 12 && isDigits(code) {
+		candidates = append(candidates, "0"+code)
+	}
+	return candidates
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isInternalBarcodeChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		r == '-' || r == '_' || r == '.'
+}
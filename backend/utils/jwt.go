@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims is the payload carried by access tokens issued on login
+type Claims struct {
+	UserID    uint   `json:"user_id"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// GenerateToken signs a new HS256 access token for the given user and session
+func GenerateToken(secret string, userID uint, role, sessionID string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	claims := Claims{
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
+}
+
+// ParseToken verifies the signature and expiry of an access token and returns its claims
+func ParseToken(secret, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.UserID == 0 || claims.SessionID == "" {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
+
+// ChallengePurposeTwoFactor marks a challenge token issued while a login awaits its second factor
+const ChallengePurposeTwoFactor = "2fa"
+
+// ChallengeClaims is the payload of a short-lived token proving the first login step succeeded.
+// It carries no session ID, so ParseToken never accepts it as an access token.
+// Method names the first step, such as "password" or "oidc".
+type ChallengeClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	Method  string `json:"method,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateChallengeToken signs a challenge token for the given user, purpose and first-step method
+func GenerateChallengeToken(secret string, userID uint, purpose, method string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	claims := ChallengeClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		Method:  method,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
+}
+
+// ParseChallengeToken verifies a challenge token and checks that it was issued for the expected purpose
+func ParseChallengeToken(secret, tokenString, purpose string) (*ChallengeClaims, error) {
+	claims := &ChallengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.UserID == 0 || claims.Purpose != purpose {
+		return nil, errors.New("invalid challenge token")
+	}
+
+	return claims, nil
+}
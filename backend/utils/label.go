@@ -0,0 +1,462 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Label symbologies
+const (
+	LabelCode128 = "code128"
+	LabelQR      = "qr"
+)
+
+// LabelContent is what gets printed on one label
+type LabelContent struct {
+	Payload string // encoded in the barcode or QR code
+	Title   string
+	Details []string
+}
+
+// LabelLayout describes the label size and, for PDF sheets, how labels are arranged on the page.
+// The defaults match a common 24-up A4 sheet of 3 × 8 labels measuring 63.5 × 33.9 mm.
+type LabelLayout struct {
+	PageSize      string   `json:"page_size"` // A4, A5 or Letter
+	Columns       int      `json:"columns"`
+	Rows          int      `json:"rows"`
+	LabelWidthMM  float64  `json:"label_width_mm"`
+	LabelHeightMM float64  `json:"label_height_mm"`
+	MarginTopMM   *float64 `json:"margin_top_mm"`  // centres the grid vertically when omitted
+	MarginLeftMM  *float64 `json:"margin_left_mm"` // centres the grid horizontally when omitted
+	GapXMM        *float64 `json:"gap_x_mm"`
+	GapYMM        *float64 `json:"gap_y_mm"`
+	// Skip leaves the first positions of the first sheet empty so partially used sheets can be reused
+	Skip int `json:"skip"`
+}
+
+var labelPageSizes = map[string][2]float64{
+	"A4":     {210, 297},
+	"A5":     {148, 210},
+	"LETTER": {215.9, 279.4},
+}
+
+// WithDefaults fills in every layout setting that was left empty
+func (l LabelLayout) WithDefaults() LabelLayout {
+	if l.PageSize == "" {
+		l.PageSize = "A4"
+	}
+	if l.Columns == 0 {
+		l.Columns = 3
+	}
+	if l.Rows == 0 {
+		l.Rows = 8
+	}
+	if l.LabelWidthMM == 0 {
+		l.LabelWidthMM = 63.5
+	}
+	if l.LabelHeightMM == 0 {
+		l.LabelHeightMM = 33.9
+	}
+	if l.GapXMM == nil {
+		gap := 2.5
+		l.GapXMM = &gap
+	}
+	if l.GapYMM == nil {
+		gap := 0.0
+		l.GapYMM = &gap
+	}
+
+	page, ok := labelPageSizes[strings.ToUpper(l.PageSize)]
+	if !ok {
+		return l
+	}
+	if l.MarginLeftMM == nil {
+		margin := math.Max(0, (page[0]-l.gridWidth())/2)
+		l.MarginLeftMM = &margin
+	}
+	if l.MarginTopMM == nil {
+		margin := math.Max(0, (page[1]-l.gridHeight())/2)
+		l.MarginTopMM = &margin
+	}
+	return l
+}
+
+func (l LabelLayout) gridWidth() float64 {
+	return float64(l.Columns)*l.LabelWidthMM + float64(l.Columns-1)**l.GapXMM
+}
+
+func (l LabelLayout) gridHeight() float64 {
+	return float64(l.Rows)*l.LabelHeightMM + float64(l.Rows-1)**l.GapYMM
+}
+
+// Validate checks a layout returned by WithDefaults
+func (l LabelLayout) Validate() error {
+	page, ok := labelPageSizes[strings.ToUpper(l.PageSize)]
+	if !ok {
+		return fmt.Errorf("unknown page_size %q, use A4, A5 or Letter", l.PageSize)
+	}
+	if l.Columns < 1 || l.Columns > 20 || l.Rows < 1 || l.Rows > 50 {
+		return errors.New("columns must be between 1 and 20 and rows between 1 and 50")
+	}
+	if l.LabelWidthMM < 15 || l.LabelWidthMM > 300 || l.LabelHeightMM < 10 || l.LabelHeightMM > 300 {
+		return errors.New("labels must be 15-300 mm wide and 10-300 mm high")
+	}
+	if *l.MarginTopMM < 0 || *l.MarginLeftMM < 0 || *l.GapXMM < 0 || *l.GapYMM < 0 {
+		return errors.New("margins and gaps cannot be negative")
+	}
+	const tolerance = 0.01
+	if *l.MarginLeftMM+l.gridWidth() > page[0]+tolerance || *l.MarginTopMM+l.gridHeight() > page[1]+tolerance {
+		return errors.New("labels do not fit on the page with this layout")
+	}
+	if l.Skip < 0 || l.Skip >= l.Columns*l.Rows {
+		return fmt.Errorf("skip must be between 0 and %d", l.Columns*l.Rows-1)
+	}
+	return nil
+}
+
+// ValidateLabelPayload checks that a payload can be encoded with the symbology
+func ValidateLabelPayload(symbology, payload string) error {
+	_, err := labelModules(symbology, payload)
+	return err
+}
+
+type labelRect struct {
+	x, y, w, h float64
+}
+
+// labelGeometry places the label elements in millimetres relative to the label's top-left corner
+type labelGeometry struct {
+	code  labelRect
+	lines []labelRect
+	// stacked puts every detail on its own line next to a QR code instead of one line under a barcode
+	stacked bool
+}
+
+func newLabelGeometry(symbology string, w, h float64) labelGeometry {
+	pad := math.Min(math.Max(math.Min(w, h)*0.06, 1), 3)
+	textH := math.Min(math.Max(h*0.13, 2), 5)
+
+	if symbology == LabelQR {
+		side := math.Min(h-2*pad, w/2)
+		textX := 2*pad + side
+		geo := labelGeometry{code: labelRect{pad, pad, side, side}, stacked: true}
+		for y := pad; y+textH <= h-pad; y += textH * 1.4 {
+			geo.lines = append(geo.lines, labelRect{textX, y, w - textX - pad, textH})
+		}
+		return geo
+	}
+
+	return labelGeometry{
+		code: labelRect{pad, pad + textH*1.3, w - 2*pad, h - 2*pad - textH*2.6},
+		lines: []labelRect{
+			{pad, pad, w - 2*pad, textH},
+			{pad, h - pad - textH, w - 2*pad, textH},
+		},
+	}
+}
+
+// texts returns the text for each line of the geometry
+func (g labelGeometry) texts(content LabelContent) []string {
+	if !g.stacked {
+		return []string{content.Title, strings.Join(content.Details, " | ")}
+	}
+	texts := append([]string{content.Title}, content.Details...)
+	if len(texts) > len(g.lines) {
+		texts = texts[:len(g.lines)]
+	}
+	return texts
+}
+
+// moduleGrid holds the dark modules of an encoded symbol including its quiet zone
+type moduleGrid struct {
+	cols, rows int
+	dark       [][]bool
+	// symbolCols excludes the quiet zone; ZPL printers encode the symbol themselves and only need its size
+	symbolCols int
+}
+
+func labelModules(symbology, payload string) (*moduleGrid, error) {
+	if payload == "" {
+		return nil, errors.New("label payload is empty")
+	}
+
+	var code barcode.Barcode
+	var err error
+	quiet := 0
+	switch symbology {
+	case LabelCode128:
+		if _, err := NormalizeBarcode(BarcodeCode128, payload); err != nil {
+			return nil, err
+		}
+		code, err = code128.Encode(payload)
+		quiet = 10
+	case LabelQR:
+		code, err = qr.Encode(payload, qr.M, qr.Auto)
+		quiet = 2
+	default:
+		return nil, fmt.Errorf("unknown symbology %q, use code128 or qr", symbology)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := code.Bounds()
+	grid := &moduleGrid{cols: bounds.Dx() + 2*quiet, rows: bounds.Dy(), symbolCols: bounds.Dx()}
+	if symbology == LabelQR {
+		grid.rows += 2 * quiet
+	}
+	grid.dark = make([][]bool, grid.rows)
+	for y := range grid.dark {
+		grid.dark[y] = make([]bool, grid.cols)
+	}
+	rowOffset := 0
+	if symbology == LabelQR {
+		rowOffset = quiet
+	}
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b, _ := code.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			grid.dark[y+rowOffset][x+quiet] = r+g+b < 3*0x8000
+		}
+	}
+	return grid, nil
+}
+
+// fit scales the grid into the area, keeping modules square for 2D symbols, and returns the module size and origin
+func (g *moduleGrid) fit(area labelRect, square bool) (mw, mh, x, y float64) {
+	mw = area.w / float64(g.cols)
+	mh = area.h / float64(g.rows)
+	if square {
+		mw = math.Min(mw, mh)
+		mh = mw
+	}
+	x = area.x + (area.w-mw*float64(g.cols))/2
+	y = area.y + (area.h-mh*float64(g.rows))/2
+	return mw, mh, x, y
+}
+
+// runs calls fn for every horizontal run of dark modules
+func (g *moduleGrid) runs(fn func(col, row, length int)) {
+	for row, line := range g.dark {
+		for col := 0; col < len(line); {
+			if !line[col] {
+				col++
+				continue
+			}
+			start := col
+			for col < len(line) && line[col] {
+				col++
+			}
+			fn(start, row, col-start)
+		}
+	}
+}
+
+var (
+	labelFontOnce sync.Once
+	labelFont     *opentype.Font
+	labelFontErr  error
+)
+
+// RenderLabelPNG renders a single label as a PNG at the given resolution
+func RenderLabelPNG(content LabelContent, layout LabelLayout, symbology string, dpi int) ([]byte, error) {
+	grid, err := labelModules(symbology, content.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	labelFontOnce.Do(func() {
+		labelFont, labelFontErr = opentype.Parse(goregular.TTF)
+	})
+	if labelFontErr != nil {
+		return nil, labelFontErr
+	}
+
+	dpmm := float64(dpi) / 25.4
+	px := func(mm float64) int { return int(math.Round(mm * dpmm)) }
+
+	img := image.NewGray(image.Rect(0, 0, px(layout.LabelWidthMM), px(layout.LabelHeightMM)))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	geo := newLabelGeometry(symbology, layout.LabelWidthMM, layout.LabelHeightMM)
+	mw, mh, ox, oy := grid.fit(geo.code, symbology == LabelQR)
+	// Modules snapped to whole pixels keep every bar the same width, which scanners depend on
+	if snapped := math.Floor(mw*dpmm) / dpmm; snapped > 0 {
+		ox += (mw - snapped) * float64(grid.cols) / 2
+		if symbology == LabelQR {
+			oy += (mh - snapped) * float64(grid.rows) / 2
+			mh = snapped
+		}
+		mw = snapped
+	}
+	grid.runs(func(col, row, length int) {
+		bar := image.Rect(
+			px(ox+float64(col)*mw), px(oy+float64(row)*mh),
+			px(ox+float64(col+length)*mw), px(oy+float64(row+1)*mh),
+		)
+		draw.Draw(img, bar, image.Black, image.Point{}, draw.Src)
+	})
+
+	// Text height is in millimetres, font size in points
+	face, err := opentype.NewFace(labelFont, &opentype.FaceOptions{
+		Size:    geo.lines[0].h / 25.4 * 72,
+		DPI:     float64(dpi),
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(color.Black), Face: face}
+	for i, text := range geo.texts(content) {
+		area := geo.lines[i]
+		text = fitText(text, func(s string) float64 {
+			return float64(drawer.MeasureString(s).Round()) / dpmm
+		}, area.w)
+		drawer.Dot = fixed.P(px(area.x), px(area.y+area.h*0.8))
+		drawer.DrawString(text)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderLabelPDF lays the labels out on as many sheets as needed, drawing barcodes as vector graphics
+func RenderLabelPDF(contents []LabelContent, layout LabelLayout, symbology string) ([]byte, error) {
+	grids := make([]*moduleGrid, len(contents))
+	for i, content := range contents {
+		grid, err := labelModules(symbology, content.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("label %d: %w", i+1, err)
+		}
+		grids[i] = grid
+	}
+
+	pageSize := strings.ToUpper(layout.PageSize)
+	if pageSize == "LETTER" {
+		pageSize = "Letter"
+	}
+	pdf := fpdf.New("P", "mm", pageSize, "")
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetCreator("inventory-backend", false)
+	pdf.SetFillColor(0, 0, 0)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	geo := newLabelGeometry(symbology, layout.LabelWidthMM, layout.LabelHeightMM)
+	perPage := layout.Columns * layout.Rows
+	for i, content := range contents {
+		slot := layout.Skip + i
+		if i == 0 || slot%perPage == 0 {
+			pdf.AddPage()
+		}
+		pos := slot % perPage
+		lx := *layout.MarginLeftMM + float64(pos%layout.Columns)*(layout.LabelWidthMM+*layout.GapXMM)
+		ly := *layout.MarginTopMM + float64(pos/layout.Columns)*(layout.LabelHeightMM+*layout.GapYMM)
+
+		mw, mh, ox, oy := grids[i].fit(geo.code, symbology == LabelQR)
+		grids[i].runs(func(col, row, length int) {
+			pdf.Rect(lx+ox+float64(col)*mw, ly+oy+float64(row)*mh, float64(length)*mw, mh, "F")
+		})
+
+		// 1 pt = 0.3528 mm
+		pdf.SetFont("Helvetica", "", geo.lines[0].h/0.3528)
+		for j, text := range geo.texts(content) {
+			area := geo.lines[j]
+			pdf.Text(lx+area.x, ly+area.y+area.h*0.8, fitText(tr(text), pdf.GetStringWidth, area.w))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderLabelZPL produces one ZPL II label format per content for thermal printers at the given resolution
+func RenderLabelZPL(contents []LabelContent, layout LabelLayout, symbology string, dpi int) (string, error) {
+	dpmm := float64(dpi) / 25.4
+	dots := func(mm float64) int { return int(math.Round(mm * dpmm)) }
+	geo := newLabelGeometry(symbology, layout.LabelWidthMM, layout.LabelHeightMM)
+	fontH := dots(geo.lines[0].h)
+
+	var b strings.Builder
+	for i, content := range contents {
+		grid, err := labelModules(symbology, content.Payload)
+		if err != nil {
+			return "", fmt.Errorf("label %d: %w", i+1, err)
+		}
+
+		fmt.Fprintf(&b, "^XA\n^CI28\n^PW%d\n^LL%d\n^LH0,0\n", dots(layout.LabelWidthMM), dots(layout.LabelHeightMM))
+
+		switch symbology {
+		case LabelQR:
+			// The magnification is sized on the grid including its quiet zone so the symbol keeps a margin
+			mag := clampInt(dots(geo.code.w)/grid.cols, 1, 10)
+			fmt.Fprintf(&b, "^FO%d,%d^BQN,2,%d^FH^FDMA,%s^FS\n", dots(geo.code.x), dots(geo.code.y), mag, zplEscape(content.Payload))
+		default:
+			module := clampInt(dots(geo.code.w)/grid.cols, 1, 10)
+			x := dots(geo.code.x) + (dots(geo.code.w)-module*grid.symbolCols)/2
+			fmt.Fprintf(&b, "^FO%d,%d^BY%d^BCN,%d,N,N,N,A^FH^FD%s^FS\n", x, dots(geo.code.y), module, dots(geo.code.h), zplEscape(content.Payload))
+		}
+
+		// Font 0 characters are roughly half as wide as they are high
+		maxWidth := func(s string) float64 { return float64(len([]rune(s))) * float64(fontH) * 0.55 }
+		for j, text := range geo.texts(content) {
+			area := geo.lines[j]
+			text = fitText(text, maxWidth, float64(dots(area.w)))
+			fmt.Fprintf(&b, "^FO%d,%d^A0N,%d,%d^FH^FD%s^FS\n", dots(area.x), dots(area.y), fontH, fontH, zplEscape(text))
+		}
+
+		b.WriteString("^XZ\n")
+	}
+	return b.String(), nil
+}
+
+// fitText shortens text with an ellipsis until measure reports it fits the width
+func fitText(text string, measure func(string) float64, width float64) string {
+	text = strings.TrimSpace(text)
+	if measure(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimSpace(string(runes)) + "..."
+		if measure(candidate) <= width {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// zplEscape hex-encodes the characters ZPL treats as commands; fields using it must be preceded by ^FH
+func zplEscape(s string) string {
+	return strings.NewReplacer("_", "_5F", "^", "_5E", "~", "_7E").Replace(s)
+}
+
+func clampInt(v, lo, hi int) int {
+	return int(math.Max(float64(lo), math.Min(float64(hi), float64(v))))
+}
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCConfig configures single sign-on against an OpenID Connect identity provider
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// EmailClaim and GroupsClaim name the ID token claims mapped onto the user's email and role
+	EmailClaim  string
+	GroupsClaim string
+	// Members of AdminGroups become admins; if StaffGroups is set, users must be in one of them or AdminGroups
+	AdminGroups []string
+	StaffGroups []string
+	// AutoProvision creates a local account on first login instead of requiring an existing one
+	AutoProvision bool
+	// TrustUnverifiedEmail links and provisions accounts by email even without email_verified=true.
+	// Only enable it for identity providers that do not let users choose their own email.
+	TrustUnverifiedEmail bool
+	// TrustIdPMFA lets SSO logins skip the local second factor of users with 2FA enabled.
+	// Only enable it when the identity provider enforces MFA itself.
+	TrustIdPMFA bool
+}
+
+// Enabled reports whether SSO is configured
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+// OIDCProvider holds the discovered endpoints and signing keys of an identity provider
+type OIDCProvider struct {
+	config                OIDCConfig
+	client                *http.Client
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	IssuerURL             string `json:"issuer"`
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+}
+
+var (
+	oidcProvidersMu sync.Mutex
+	oidcProviders   = map[string]*OIDCProvider{}
+)
+
+// GetOIDCProvider returns the provider for the configured issuer, running discovery on first use
+func GetOIDCProvider(ctx context.Context, cfg OIDCConfig) (*OIDCProvider, error) {
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+
+	if p, ok := oidcProviders[cfg.Issuer]; ok {
+		return p, nil
+	}
+
+	p := &OIDCProvider{config: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+	discoveryURL := strings.TrimRight(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discoveryURL, p); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if p.IssuerURL != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery returned issuer %q, expected %q", p.IssuerURL, cfg.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is missing required endpoints")
+	}
+
+	oidcProviders[cfg.Issuer] = p
+	return p, nil
+}
+
+// GeneratePKCEVerifier returns a random code verifier and its S256 code challenge
+func GeneratePKCEVerifier() (verifier, challenge string, err error) {
+	verifier, err = GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL builds the authorization request URL for the auth-code flow with PKCE
+func (p *OIDCProvider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + params.Encode()
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (jwt.MapClaims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.VerifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, idToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// signingKey returns the JWKS key with the given ID, refetching the key set once if it is unknown
+func (p *OIDCProvider) signingKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	// Providers rotate keys, so an unknown kid triggers a refresh
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+
+	p.keys = map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no signing key found for kid %q", kid)
+}
+
+// lookupKey finds a cached key; a token without kid matches when the set holds a single key
+func (p *OIDCProvider) lookupKey(kid string) *rsa.PublicKey {
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MaxPasswordBytes is the longest password bcrypt can hash
+const MaxPasswordBytes = 72
+
+// PasswordPolicy describes the requirements a new password must meet
+type PasswordPolicy struct {
+	MinLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	HistorySize    int // number of previous passwords that may not be reused
+	DisallowCommon bool
+}
+
+// commonPasswords is a blocklist of frequently used passwords, compared case-insensitively
+var commonPasswords = map[string]bool{}
+
+func init() {
+	for _, p := range []string{
+		"123456", "123456789", "12345678", "12345", "1234567", "1234567890", "123123", "111111",
+		"000000", "654321", "666666", "121212", "123321", "112233", "987654321", "1q2w3e4r",
+		"1q2w3e", "qwerty", "qwerty123", "qwertyuiop", "asdfghjkl", "zxcvbnm", "abc123", "abcd1234",
+		"password", "password1", "password123", "passw0rd", "p@ssw0rd", "p@ssword", "admin", "admin123",
+		"administrator", "root", "toor", "letmein", "welcome", "welcome1", "welcome123", "iloveyou",
+		"monkey", "dragon", "football", "baseball", "sunshine", "princess", "master", "shadow",
+		"superman", "batman", "trustno1", "starwars", "whatever", "freedom", "changeme", "secret",
+		"login", "guest", "test", "test123", "default", "qazwsx", "1qaz2wsx", "aa123456",
+		"inventory", "inventory123", "gudang", "gudang123", "rahasia", "rahasia123", "bismillah", "indonesia",
+		"sayang", "sayangku", "cintaku", "katasandi", "admin1234", "staff", "staff123", "user123",
+	} {
+		commonPasswords[p] = true
+	}
+}
+
+// Validate returns the list of policy violations for a password; an empty list means it is acceptable.
+// The email and name of the account owner are used to reject passwords containing them.
+func (p PasswordPolicy) Validate(password, email, name string) []string {
+	var violations []string
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > MaxPasswordBytes {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", MaxPasswordBytes))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	lower := strings.ToLower(password)
+	if p.DisallowCommon && commonPasswords[lower] {
+		violations = append(violations, "is too common")
+	}
+
+	if containsPersonalInfo(lower, email, name) {
+		violations = append(violations, "must not contain your email or name")
+	}
+
+	return violations
+}
+
+// containsPersonalInfo reports whether the password contains the email local part or a part of the name
+func containsPersonalInfo(password, email, name string) bool {
+	var parts []string
+	if local, _, found := strings.Cut(strings.ToLower(email), "@"); found {
+		parts = append(parts, local)
+	}
+	parts = append(parts, strings.Fields(strings.ToLower(name))...)
+
+	for _, part := range parts {
+		// Very short fragments would reject too many unrelated passwords
+		if len(part) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
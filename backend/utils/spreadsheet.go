@@ -0,0 +1,377 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Limits guarding against zip bombs and sheets padded out to the last column
+const (
+	maxSpreadsheetPart    = 64 << 20 // uncompressed bytes per XLSX part
+	maxSpreadsheetColumns = 256
+)
+
+// ErrTooManyRows is returned when a spreadsheet has more non-blank rows than the caller allows
+var ErrTooManyRows = errors.New("spreadsheet has too many rows")
+
+// SpreadsheetRow is a non-empty row of a spreadsheet with its 1-based line number
+type SpreadsheetRow struct {
+	Line  int
+	Cells []string
+}
+
+// ReadSpreadsheet reads the rows of a CSV file or of the first sheet of an XLSX workbook, stopping with
+// ErrTooManyRows after maxRows non-blank rows. The format is detected from the content; CSV may be
+// separated by commas, semicolons or tabs.
+func ReadSpreadsheet(data []byte, maxRows int) ([]SpreadsheetRow, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return readXLSX(data, maxRows)
+	case bytes.HasPrefix(data, []byte{0xD0, 0xCF, 0x11, 0xE0}):
+		return nil, errors.New("legacy .xls files are not supported, save the sheet as .xlsx or CSV")
+	default:
+		return readCSV(data, maxRows)
+	}
+}
+
+func readCSV(data []byte, maxRows int) ([]SpreadsheetRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	delimiter, best := ',', bytes.Count(firstLine, []byte(","))
+	for _, d := range []rune{';', '\t'} {
+		if n := bytes.Count(firstLine, []byte(string(d))); n > best {
+			delimiter, best = d, n
+		}
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var rows []SpreadsheetRow
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if isBlankRow(record) {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, ErrTooManyRows
+		}
+		line, _ := r.FieldPos(0)
+		rows = append(rows, SpreadsheetRow{Line: line, Cells: record})
+	}
+	return rows, nil
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a shared or inline string, either plain or split into rich text runs
+type xlsxText struct {
+	T    *string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if t.T != nil {
+		return *t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+// xlsxCell is a single <c> element of a sheet
+type xlsxCell struct {
+	Ref    string   `xml:"r,attr"`
+	Type   string   `xml:"t,attr"`
+	Value  string   `xml:"v"`
+	Inline xlsxText `xml:"is"`
+}
+
+// readXLSX streams the first sheet so memory stays bounded by the row limit rather than the sheet size
+func readXLSX(data []byte, maxRows int) ([]SpreadsheetRow, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX file: %w", err)
+	}
+
+	sheetPath, err := firstSheetPath(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedStrings, err := readSharedStrings(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	part, err := openXLSXPart(zr, sheetPath)
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	var rows []SpreadsheetRow
+	var cells []string
+	line, col := 0, 0
+	dec := xml.NewDecoder(part)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, xlsxError(sheetPath, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				line++
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "r" {
+						if n, err := strconv.Atoi(attr.Value); err == nil && n > 0 {
+							line = n
+						}
+					}
+				}
+				cells, col = nil, 0
+			case "c":
+				var cell xlsxCell
+				if err := dec.DecodeElement(&cell, &t); err != nil {
+					return nil, xlsxError(sheetPath, err)
+				}
+				if cell.Ref != "" {
+					if col, err = xlsxColumn(cell.Ref); err != nil {
+						return nil, err
+					}
+				}
+				value, err := xlsxCellValue(cell, sharedStrings)
+				if err != nil {
+					return nil, err
+				}
+				// Cells far to the right are stray formatting rather than data
+				if col < maxSpreadsheetColumns {
+					for len(cells) <= col {
+						cells = append(cells, "")
+					}
+					cells[col] = value
+				}
+				col++
+			}
+		case xml.EndElement:
+			if t.Name.Local != "row" || isBlankRow(cells) {
+				continue
+			}
+			if len(rows) == maxRows {
+				return nil, ErrTooManyRows
+			}
+			rows = append(rows, SpreadsheetRow{Line: line, Cells: cells})
+		}
+	}
+	return rows, nil
+}
+
+func xlsxCellValue(cell xlsxCell, sharedStrings []string) (string, error) {
+	switch cell.Type {
+	case "s":
+		idx, err := strconv.Atoi(cell.Value)
+		if err != nil || idx < 0 || idx >= len(sharedStrings) {
+			return "", fmt.Errorf("invalid shared string reference in cell %s", cell.Ref)
+		}
+		return sharedStrings[idx], nil
+	case "inlineStr":
+		return cell.Inline.String(), nil
+	case "b":
+		if cell.Value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case "", "n":
+		// Numbers are stored in their shortest round-trip form, but may use exponent notation
+		if f, err := strconv.ParseFloat(cell.Value, 64); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+		return cell.Value, nil
+	default:
+		return cell.Value, nil
+	}
+}
+
+// readSharedStrings streams the shared string table; workbooks without one are valid
+func readSharedStrings(zr *zip.Reader) ([]string, error) {
+	const name = "xl/sharedStrings.xml"
+	part, err := openXLSXPart(zr, name)
+	if errors.Is(err, errPartMissing) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	var sharedStrings []string
+	dec := xml.NewDecoder(part)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return sharedStrings, nil
+		}
+		if err != nil {
+			return nil, xlsxError(name, err)
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "si" {
+			var item xlsxText
+			if err := dec.DecodeElement(&item, &start); err != nil {
+				return nil, xlsxError(name, err)
+			}
+			sharedStrings = append(sharedStrings, item.String())
+		}
+	}
+}
+
+// errPartMissing is returned for absent parts; only the shared strings are optional
+var errPartMissing = errors.New("invalid XLSX file: missing")
+
+// firstSheetPath resolves the part holding the first sheet of the workbook
+func firstSheetPath(zr *zip.Reader) (string, error) {
+	var workbook xlsxWorkbook
+	if err := readXLSXPart(zr, "xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("invalid XLSX file: workbook has no sheets")
+	}
+
+	var rels xlsxRelationships
+	if err := readXLSXPart(zr, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].RelID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", errors.New("invalid XLSX file: first sheet not found")
+}
+
+func readXLSXPart(zr *zip.Reader, name string, v interface{}) error {
+	part, err := openXLSXPart(zr, name)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+
+	if err := xml.NewDecoder(part).Decode(v); err != nil {
+		return xlsxError(name, err)
+	}
+	return nil
+}
+
+// openXLSXPart opens a part of the workbook; reads fail once it exceeds maxSpreadsheetPart
+func openXLSXPart(zr *zip.Reader, name string) (io.ReadCloser, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid XLSX file: %w", err)
+		}
+		return &limitedPart{ReadCloser: rc, remaining: maxSpreadsheetPart}, nil
+	}
+	return nil, fmt.Errorf("%w %s", errPartMissing, name)
+}
+
+type limitedPart struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (p *limitedPart) Read(b []byte) (int, error) {
+	if p.remaining <= 0 {
+		return 0, errPartTooLarge
+	}
+	if int64(len(b)) > p.remaining {
+		b = b[:p.remaining]
+	}
+	n, err := p.ReadCloser.Read(b)
+	p.remaining -= int64(n)
+	return n, err
+}
+
+var errPartTooLarge = errors.New("XLSX sheet is too large")
+
+func xlsxError(name string, err error) error {
+	if errors.Is(err, errPartTooLarge) {
+		return err
+	}
+	return fmt.Errorf("invalid XLSX file: %s: %w", name, err)
+}
+
+// xlsxColumn returns the 0-based column index of a cell reference such as "AB12"
+func xlsxColumn(ref string) (int, error) {
+	col := 0
+	for i := 0; i < len(ref); i++ {
+		ch := ref[i]
+		if ch >= 'a' && ch <= 'z' {
+			ch -= 'a' - 'A'
+		}
+		if ch < 'A' || ch > 'Z' {
+			if i == 0 {
+				break
+			}
+			return col - 1, nil
+		}
+		col = col*26 + int(ch-'A'+1)
+		if col > 16384 {
+			break
+		}
+	}
+	return 0, fmt.Errorf("invalid XLSX cell reference %q", ref)
+}
+
+func isBlankRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrFileNotFound is returned by a Storage when no file is stored under a key
+var ErrFileNotFound = errors.New("file not found")
+
+// Storage keeps uploaded files under slash-separated keys
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// StorageConfig selects and configures the file storage backend
+type StorageConfig struct {
+	// Driver is "local" (default) or "s3"
+	Driver   string
+	LocalDir string
+	// S3 settings; any S3-compatible service such as MinIO works when Endpoint points at it
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	// S3PathStyle addresses objects as endpoint/bucket/key, which MinIO and most self-hosted services need
+	S3PathStyle bool
+}
+
+// NewStorage creates the storage backend described by the config
+func NewStorage(cfg StorageConfig) (Storage, error) {
+	switch cfg.Driver {
+	case "", "local":
+		if err := os.MkdirAll(cfg.LocalDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+		return &LocalStorage{Root: cfg.LocalDir}, nil
+	case "s3":
+		if cfg.S3Bucket == "" || cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+			return nil, errors.New("s3 storage needs a bucket, access key and secret key")
+		}
+		endpoint := cfg.S3Endpoint
+		if endpoint == "" {
+			endpoint = "https://s3." + cfg.S3Region + ".amazonaws.com"
+		}
+		u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+		}
+		return &S3Storage{config: cfg, endpoint: u, client: &http.Client{Timeout: time.Minute}}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q, use local or s3", cfg.Driver)
+	}
+}
+
+// LocalStorage stores files in a directory on the local filesystem
+type LocalStorage struct {
+	Root string
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file atomically so readers never see a partial upload
+func (s *LocalStorage) Put(_ context.Context, key string, data []byte, _ string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrFileNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStorage) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// S3Storage stores files in an S3-compatible bucket, signing requests with AWS Signature Version 4
+type S3Storage struct {
+	config   StorageConfig
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("s3 put returned %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrFileNotFound
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 get returned %d: %s", resp.StatusCode, body)
+	}
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("s3 delete returned %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// do sends a signed request for an object
+func (s *S3Storage) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	host := s.endpoint.Host
+	path := "/" + s3EscapePath(key)
+	if s.config.S3PathStyle {
+		path = "/" + s.config.S3Bucket + path
+	} else {
+		host = s.config.S3Bucket + "." + host
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint.Scheme+"://"+host+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, host, path, body, time.Now().UTC())
+
+	return s.client.Do(req)
+}
+
+// sign adds the SigV4 headers; only host and the x-amz-* headers are signed
+func (s *S3Storage) sign(req *http.Request, host, path string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		"",
+		"host:" + host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.config.S3Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.config.S3SecretKey), date)
+	key = hmacSHA256(key, s.config.S3Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.S3AccessKey, scope, signedHeaders, signature))
+}
+
+// s3EscapePath percent-encodes every byte of the key except unreserved characters and slashes
+func s3EscapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}